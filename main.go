@@ -8,20 +8,43 @@
 //	GET  /api/session       - Issue signed session token
 //	GET  /api/metadata      - Project metadata from deepgram.toml
 //	WS   /api/voice-agent   - WebSocket proxy to Deepgram Agent API (auth required)
+//	GET  /api/version       - Build version, commit and time
 //	GET  /health            - Health check
+//
+// Admin routes (only registered when ADMIN_TOKEN is set):
+//
+//	GET  /api/admin/connections - List active voice agent connections
+//	GET  /api/admin/config      - Active server configuration (secrets redacted)
+//	GET  /api/admin/stats       - Connection and traffic counters
+//	POST /api/admin/sessions/{id}/inject - Make a session's agent speak the given text
+//	GET  /api/admin/sessions/{id}/transcript - Conversation transcript of a session
+//	POST /api/admin/sessions/{id}/kick - End a session
+//	POST /api/admin/shutdown    - Gracefully shut down the server
 package main
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -34,6 +57,14 @@ import (
 // CONFIGURATION
 // ============================================================================
 
+// Build information, set at build time with
+// -ldflags "-X main.Version=... -X main.Commit=... -X main.BuildTime=...".
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
 // appConfig holds all application configuration.
 var appConfig struct {
 	deepgramAPIKey   string
@@ -41,6 +72,67 @@ var appConfig struct {
 	port             string
 	host             string
 	sessionSecret    []byte
+	adminToken       string
+	tlsCertFile      string
+	tlsKeyFile       string
+	allowedOrigins   []string
+	allowAllOrigins  bool
+	trustedProxies   []*net.IPNet // besides loopback, whose X-Forwarded-For is honoured
+	maxConnections   int
+	maxMessageBytes  int
+	maxOutboundBytes int
+	writeTimeout     time.Duration
+	inputRateLimit   int
+	idleTimeout      time.Duration
+	singleSession    bool
+	connectAttempts  int
+	debug            bool
+	accessLog        bool
+
+	// redactTranscripts masks emails, phone numbers and card numbers, plus
+	// matches of the optional redactPattern, in recorded transcripts.
+	// Messages forwarded to the browser are unchanged.
+	redactTranscripts bool
+	redactPattern     string
+
+	// keepAliveInterval is how often a ping frame is sent to each browser connection
+	// so that intermediate proxies do not drop it during long pauses (zero disables).
+	keepAliveInterval time.Duration
+
+	// metricsEvents enables per-turn metrics messages (e.g. latency) to the browser.
+	metricsEvents bool
+
+	// heartbeatInterval is how often a heartbeat message carrying the server
+	// time is sent to each browser connection (zero disables).
+	heartbeatInterval time.Duration
+
+	// Agent audio coalescing (disabled when audioCoalesceWindow is zero)
+	audioCoalesceWindow time.Duration
+	audioCoalesceBytes  int
+}
+
+// defaultAllowedOrigins are the origins accepted when ALLOWED_ORIGINS is unset.
+// They cover the Vite dev server used by `make start`.
+const defaultAllowedOrigins = "http://localhost:8080,http://127.0.0.1:8080"
+
+// getEnvInt reads a non-negative integer from the environment, returning def when unset.
+func getEnvInt(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return def, fmt.Errorf("%s must be a non-negative integer, got %q", name, value)
+	}
+	return n, nil
+}
+
+// debugf logs a message only when LOG_LEVEL=debug.
+func debugf(format string, args ...interface{}) {
+	if appConfig.debug {
+		log.Printf("DEBUG: "+format, args...)
+	}
 }
 
 // reservedCloseCodes lists WebSocket close codes that cannot be set by applications.
@@ -57,19 +149,409 @@ var reservedCloseCodes = map[int]bool{
 // ============================================================================
 
 // activeConnections tracks all active WebSocket connections for graceful shutdown.
+// Keys are *websocket.Conn and values are the connection's *connInfo.
 var activeConnections sync.Map
 
+// connInfo describes an active browser connection for logging and the admin API.
+type connInfo struct {
+	ID          string
+	RemoteAddr  string
+	UserAgent   string
+	ConnectedAt time.Time
+
+	// agentAudioBytes counts agent audio received from Deepgram for the client.
+	agentAudioBytes atomic.Int64
+
+	// agentSpeaking is 1 from AgentStartedSpeaking until AgentAudioDone or a
+	// barge-in (UserStartedSpeaking) (atomic).
+	agentSpeaking int32
+
+	// cancel ends the session from outside its goroutines, e.g. an admin kick.
+	cancel context.CancelCauseFunc
+
+	// client is the browser connection. Data writes go through writeToClient so
+	// that messages generated by the proxy cannot interleave with forwarded ones.
+	clientMu sync.Mutex
+	client   *websocket.Conn
+
+	// deepgram is the session's upstream connection, nil until the dial succeeds.
+	// All writes to it go through writeToDeepgram so that admin requests can
+	// send messages alongside the client forwarding goroutine.
+	deepgramMu sync.Mutex
+	deepgram   *websocket.Conn
+
+	// transcript holds the most recent ConversationText turns (see maxTranscriptTurns).
+	// It stays empty when ADMIN_TOKEN is unset, since nothing could read it.
+	transcriptMu sync.Mutex
+	transcript   []transcriptEntry
+}
+
+// transcriptEntry is one ConversationText turn recorded for the admin transcript API.
+type transcriptEntry struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// maxTranscriptTurns bounds the per-session transcript kept in memory.
+const maxTranscriptTurns = 100
+
+// transcriptRetention is how long a session's transcript stays available after it ends.
+const transcriptRetention = 5 * time.Minute
+
+// endedTranscripts holds transcripts of recently ended sessions, keyed by session ID.
+var endedTranscripts sync.Map
+
+// redaction replaces matches of pattern with replacement.
+type redaction struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// redactions are the patterns masked in recorded transcripts when
+// REDACT_TRANSCRIPTS is enabled; REDACT_PATTERN appends one more at startup.
+// Card numbers are matched before phone numbers so a long digit run is not
+// partially masked as a phone number.
+var redactions = []redaction{
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	{regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), "[CARD]"},
+	{regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{3}\)|\b\d{3})[\s.-]?\d{3}[\s.-]?\d{4}\b`), "[PHONE]"},
+}
+
+// redact masks personal data in conversation text.
+func redact(text string) string {
+	for _, r := range redactions {
+		text = r.pattern.ReplaceAllString(text, r.replacement)
+	}
+	return text
+}
+
+// recordTranscript appends a ConversationText message to the session transcript,
+// dropping the oldest turn once maxTranscriptTurns is reached.
+func (c *connInfo) recordTranscript(data []byte) {
+	var msg struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+	if appConfig.redactTranscripts {
+		msg.Content = redact(msg.Content)
+	}
+	c.transcriptMu.Lock()
+	defer c.transcriptMu.Unlock()
+	if len(c.transcript) >= maxTranscriptTurns {
+		c.transcript = c.transcript[1:]
+	}
+	c.transcript = append(c.transcript, transcriptEntry{
+		Role:      msg.Role,
+		Content:   msg.Content,
+		Timestamp: time.Now(),
+	})
+}
+
+// transcriptSnapshot returns a copy of the session transcript.
+func (c *connInfo) transcriptSnapshot() []transcriptEntry {
+	c.transcriptMu.Lock()
+	defer c.transcriptMu.Unlock()
+	return append([]transcriptEntry{}, c.transcript...)
+}
+
+// retainTranscript keeps an ended session's transcript available for transcriptRetention.
+func (c *connInfo) retainTranscript() {
+	endedTranscripts.Store(c.ID, c.transcriptSnapshot())
+	time.AfterFunc(transcriptRetention, func() {
+		endedTranscripts.Delete(c.ID)
+	})
+}
+
+// errDeepgramNotConnected is returned when writing to a session whose upstream
+// connection has not been established yet.
+var errDeepgramNotConnected = errors.New("deepgram connection not established")
+
+// writeToClient sends a message on the session's browser connection.
+func (c *connInfo) writeToClient(messageType int, data []byte) error {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	if err := writeMessage(c.client, messageType, data); err != nil {
+		stats.writeErrors.Add(1)
+		return err
+	}
+	stats.messagesSent.Add(1)
+	stats.bytesSent.Add(int64(len(data)))
+	return nil
+}
+
+// forwardToClient writes a message from Deepgram to the client, enforcing
+// MAX_OUTBOUND_MESSAGE_BYTES when set: larger agent audio is split across
+// several frames, and larger JSON messages are dropped with a warning.
+func (c *connInfo) forwardToClient(messageType int, data []byte) error {
+	limit := appConfig.maxOutboundBytes
+	if limit <= 0 || len(data) <= limit {
+		return c.writeToClient(messageType, data)
+	}
+	if messageType != websocket.BinaryMessage {
+		log.Printf("WARNING: dropping %d-byte %q message for session %s (limit %d bytes)",
+			len(data), peekMessageType(data), c.ID, limit)
+		return nil
+	}
+	// Split on an even boundary so no 16-bit sample is cut in half
+	chunk := max(2, limit&^1)
+	for len(data) > 0 {
+		n := min(chunk, len(data))
+		if err := c.writeToClient(messageType, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// writeToDeepgram sends a message on the session's Deepgram connection.
+func (c *connInfo) writeToDeepgram(messageType int, data []byte) error {
+	c.deepgramMu.Lock()
+	defer c.deepgramMu.Unlock()
+	if c.deepgram == nil {
+		return errDeepgramNotConnected
+	}
+	return writeMessage(c.deepgram, messageType, data)
+}
+
+// connSummary is the admin API view of a connection.
+type connSummary struct {
+	ID              string    `json:"id"`
+	RemoteAddr      string    `json:"remoteAddr"`
+	UserAgent       string    `json:"userAgent"`
+	ConnectedAt     time.Time `json:"connectedAt"`
+	AgentAudioBytes int64     `json:"agentAudioBytes"`
+}
+
+// snapshot returns a copy of the connection info that is safe to read and encode.
+func (c *connInfo) snapshot() connSummary {
+	return connSummary{
+		ID:              c.ID,
+		RemoteAddr:      c.RemoteAddr,
+		UserAgent:       c.UserAgent,
+		ConnectedAt:     c.ConnectedAt,
+		AgentAudioBytes: c.agentAudioBytes.Load(),
+	}
+}
+
+// newSessionID returns a random identifier for a voice agent session.
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// clientAddr returns the client's address for logging.
+// Behind the Caddy reverse proxy, it comes from X-Forwarded-For. The header is
+// only trusted from loopback (Caddy runs alongside the server) or TRUSTED_PROXIES,
+// since any client reaching the server directly could set it.
+func clientAddr(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" && isTrustedProxy(r.RemoteAddr) {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	return r.RemoteAddr
+}
+
+// isTrustedProxy reports whether a request's RemoteAddr belongs to a reverse
+// proxy whose X-Forwarded-For header can be believed.
+func isTrustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, network := range appConfig.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses a comma-separated list of IP addresses and CIDR ranges.
+func parseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// newConnInfo captures connection metadata from the upgrade request.
+func newConnInfo(r *http.Request) *connInfo {
+	return &connInfo{
+		ID:          newSessionID(),
+		RemoteAddr:  clientAddr(r),
+		UserAgent:   r.UserAgent(),
+		ConnectedAt: time.Now(),
+	}
+}
+
+// agentsSpeaking returns the number of sessions whose agent is mid-utterance.
+func agentsSpeaking() int {
+	count := 0
+	activeConnections.Range(func(key, value interface{}) bool {
+		if atomic.LoadInt32(&value.(*connInfo).agentSpeaking) == 1 {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// findSession returns the active session with the given ID, or nil.
+func findSession(id string) *connInfo {
+	var found *connInfo
+	activeConnections.Range(func(key, value interface{}) bool {
+		if info := value.(*connInfo); info.ID == id {
+			found = info
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// listConnections returns a snapshot of all active connections.
+func listConnections() []connSummary {
+	conns := []connSummary{}
+	activeConnections.Range(func(key, value interface{}) bool {
+		conns = append(conns, value.(*connInfo).snapshot())
+		return true
+	})
+	return conns
+}
+
+// errTooManyConnections is returned by reserveConnection when MAX_CONNECTIONS is reached.
+var errTooManyConnections = errors.New("too many active connections")
+
+// reservedConnections counts connection slots held by in-progress or active sessions.
+var reservedConnections atomic.Int64
+
+// reserveConnection claims a connection slot before the WebSocket upgrade.
+// A MAX_CONNECTIONS of zero means no limit. Callers must call releaseConnection
+// once the session ends.
+func reserveConnection() error {
+	limit := int64(appConfig.maxConnections)
+	if n := reservedConnections.Add(1); limit > 0 && n > limit {
+		reservedConnections.Add(-1)
+		return errTooManyConnections
+	}
+	return nil
+}
+
+// releaseConnection frees a slot claimed by reserveConnection.
+func releaseConnection() {
+	reservedConnections.Add(-1)
+}
+
+// stats holds server-wide counters for the admin stats endpoint.
+var stats struct {
+	totalConnections atomic.Int64 // sessions accepted since startup
+	messagesSent     atomic.Int64 // messages written to browser clients
+	bytesSent        atomic.Int64 // payload bytes written to browser clients
+	writeErrors      atomic.Int64 // failed writes to browser clients
+}
+
+// serverStats is a point-in-time snapshot of stats.
+type serverStats struct {
+	ActiveConnections    int   `json:"activeConnections"`
+	TotalConnectionsEver int64 `json:"totalConnectionsEver"`
+	MessagesSent         int64 `json:"messagesSent"`
+	BytesSent            int64 `json:"bytesSent"`
+	WriteErrors          int64 `json:"writeErrors"`
+}
+
+// statsSnapshot returns the current values of the server counters.
+func statsSnapshot() serverStats {
+	return serverStats{
+		ActiveConnections:    connectionCount(),
+		TotalConnectionsEver: stats.totalConnections.Load(),
+		MessagesSent:         stats.messagesSent.Load(),
+		BytesSent:            stats.bytesSent.Load(),
+		WriteErrors:          stats.writeErrors.Load(),
+	}
+}
+
+// connectionCount returns the number of sessions in activeConnections, the same
+// set listed by /api/admin/connections. Slots reserved for upgrades still in
+// their handshake are not counted (see reservedConnections).
+func connectionCount() int {
+	count := 0
+	activeConnections.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
 // upgrader configures the WebSocket upgrade handler.
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins in development
-	},
+	CheckOrigin:     checkOrigin,
 }
 
 const jwtExpiry = time.Hour
 
+// closeIdleTimeout is the application close code sent when a client is closed for inactivity.
+const closeIdleTimeout = 4408
+
+// closeKicked is the application close code sent when an admin ends a session.
+const closeKicked = 4403
+
+// errSessionKicked is the cancellation cause for sessions ended by an admin.
+var errSessionKicked = errors.New("session ended by admin")
+
+// errSessionClosed is the cancellation cause for sessions closed by the server
+// (shutdown or single-session replacement).
+var errSessionClosed = errors.New("session closed by server")
+
+// closeUnsupportedVersion is the application close code sent to clients that
+// offer only protocol versions this server does not speak.
+const closeUnsupportedVersion = 4400
+
+// closeSuperseded is the application close code sent to sessions replaced in SINGLE_SESSION mode.
+const closeSuperseded = 4409
+
+// mutedKeepAliveInterval is the most often a KeepAlive is sent to Deepgram in
+// place of audio dropped while the client is muted. Deepgram ends sessions that
+// send neither audio nor KeepAlive for about 10 seconds.
+const mutedKeepAliveInterval = 5 * time.Second
+
+// controlWriteTimeout bounds how long writing a ping or close frame may take.
+const controlWriteTimeout = 10 * time.Second
+
 // issueToken creates a signed JWT with a 1-hour expiry.
 func issueToken(secret []byte) (string, error) {
 	claims := jwt.RegisteredClaims{
@@ -105,6 +587,55 @@ func validateWsToken(protocols []string, secret []byte) string {
 	return ""
 }
 
+// protocolVersion is the proxy's message protocol version, negotiated as a
+// WebSocket subprotocol alongside access_token.<jwt>. Clients that offer none
+// are treated as v1.
+const protocolVersion = "voiceagent.v1"
+
+// negotiateVersion picks the protocol version from the offered subprotocols.
+// It returns "" when the client offers no version, and ok is false when the
+// client offers only versions this server does not support.
+func negotiateVersion(protocols []string) (version string, ok bool) {
+	offered := false
+	for _, proto := range protocols {
+		if !strings.HasPrefix(proto, "voiceagent.") {
+			continue
+		}
+		if proto == protocolVersion {
+			return proto, true
+		}
+		offered = true
+	}
+	return "", !offered
+}
+
+// checkOrigin reports whether a WebSocket upgrade request comes from an allowed origin.
+// Requests without an Origin header (non-browser clients) and same-host requests are
+// always accepted; anything else must match ALLOWED_ORIGINS unless ALLOW_ALL_ORIGINS is set.
+func checkOrigin(r *http.Request) bool {
+	if appConfig.allowAllOrigins {
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	for _, allowed := range appConfig.allowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	log.Printf("WebSocket origin rejected: %s", origin)
+	return false
+}
+
 // ============================================================================
 // METADATA - deepgram.toml parser
 // ============================================================================
@@ -127,6 +658,278 @@ func getSafeCloseCode(code int) int {
 	return websocket.CloseNormalClosure
 }
 
+// writeMessage writes a data message with the configured write deadline, so a
+// stalled peer fails the write instead of blocking the forwarding goroutine forever.
+// A zero writeTimeout disables the deadline.
+func writeMessage(conn *websocket.Conn, messageType int, data []byte) error {
+	if appConfig.writeTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(appConfig.writeTimeout))
+	}
+	return conn.WriteMessage(messageType, data)
+}
+
+// tokenBucket is a byte-rate limiter for a single connection's inbound audio.
+// It allows bursts of up to one second of traffic and lets a single large frame
+// go into debt, which is then repaid by delaying subsequent frames.
+type tokenBucket struct {
+	rate   float64 // bytes per second
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket refilling at bytesPerSecond.
+func newTokenBucket(bytesPerSecond int) *tokenBucket {
+	return &tokenBucket{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// take consumes n bytes and returns how long the caller should wait before
+// sending them to stay within the configured rate.
+func (b *tokenBucket) take(n int) time.Duration {
+	now := time.Now()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Client disconnect categories reported by disconnectReason.
+const (
+	reasonNormal        = "normal closure"
+	reasonGoingAway     = "going away"
+	reasonNoStatus      = "closed without status"
+	reasonAbnormal      = "abnormal closure"
+	reasonProtocolError = "protocol error"
+	reasonMessageTooBig = "message too big"
+	reasonReadTimeout   = "read timeout"
+	reasonReadError     = "read error"
+)
+
+// disconnectReason classifies the error that ended a client read loop.
+// It does not log; callers log the raw error for reasonReadError.
+func disconnectReason(err error) string {
+	var netErr net.Error
+	switch {
+	case websocket.IsCloseError(err, websocket.CloseNormalClosure):
+		return reasonNormal
+	case websocket.IsCloseError(err, websocket.CloseGoingAway):
+		return reasonGoingAway
+	case websocket.IsCloseError(err, websocket.CloseNoStatusReceived):
+		return reasonNoStatus
+	case websocket.IsCloseError(err, websocket.CloseAbnormalClosure):
+		return reasonAbnormal
+	case websocket.IsCloseError(err, websocket.CloseProtocolError,
+		websocket.CloseUnsupportedData, websocket.CloseInvalidFramePayloadData):
+		return reasonProtocolError
+	case errors.Is(err, websocket.ErrReadLimit):
+		return reasonMessageTooBig
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return reasonReadTimeout
+	default:
+		return reasonReadError
+	}
+}
+
+// audioCoalescer batches consecutive binary audio frames from Deepgram into
+// larger frames, trading a little latency for fewer WebSocket writes.
+// It is driven by the forwarding loop, so it needs no locking.
+type audioCoalescer struct {
+	window   time.Duration
+	maxBytes int
+	buf      []byte
+	timer    *time.Timer // started by the first frame in an empty buffer
+}
+
+// add appends an audio frame and reports whether the buffer reached maxBytes
+// and should be flushed now. The first frame starts the window timer.
+func (c *audioCoalescer) add(data []byte) bool {
+	if len(c.buf) == 0 {
+		c.timer = time.NewTimer(c.window)
+	}
+	c.buf = append(c.buf, data...)
+	return len(c.buf) >= c.maxBytes
+}
+
+// expired returns a channel that receives once the oldest buffered frame is
+// window old. It returns nil (which blocks forever in a select) when the
+// buffer is empty or c is nil.
+func (c *audioCoalescer) expired() <-chan time.Time {
+	if c == nil || c.timer == nil {
+		return nil
+	}
+	return c.timer.C
+}
+
+// take returns the buffered audio, empties the buffer and stops the window timer.
+func (c *audioCoalescer) take() []byte {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	data := c.buf
+	c.buf = nil
+	return data
+}
+
+// deepgramMessage is one result of reading the Deepgram connection.
+type deepgramMessage struct {
+	messageType int
+	data        []byte
+	err         error
+}
+
+// Message types the proxy reads or writes. Everything else is forwarded untouched.
+const (
+	// Deepgram Agent API events the proxy observes on the way to the client
+	msgUserStartedSpeaking  = "UserStartedSpeaking"
+	msgAgentThinking        = "AgentThinking"
+	msgAgentStartedSpeaking = "AgentStartedSpeaking"
+	msgAgentAudioDone       = "AgentAudioDone"
+	msgConversationText     = "ConversationText"
+	msgWarning              = "Warning"
+
+	// Agent API messages the proxy sends itself
+	msgInjectAgentMessage = "InjectAgentMessage" // to Deepgram, from the admin inject endpoint
+	msgAgentKeepAlive     = "KeepAlive"          // to Deepgram, in place of audio dropped while muted
+	msgError              = "Error"              // to the client, when Deepgram is unreachable (Deepgram sends it too)
+
+	// Proxy control messages from the client; never forwarded to Deepgram
+	msgMute      = "mute"
+	msgUnmute    = "unmute"
+	msgKeepalive = "keepalive" // browser-leg keepalive; Deepgram's is "KeepAlive" and is forwarded
+
+	// Proxy messages to the client
+	msgMuteState  = "mute_state"
+	msgHeartbeat  = "heartbeat"
+	msgLatency    = "latency"
+	msgAudioBytes = "agent_audio_bytes"
+	msgConnecting = "connecting"
+	msgSuperseded = "superseded"
+)
+
+// peekMessageType returns the "type" field of a JSON message, or "" if it has none.
+func peekMessageType(data []byte) string {
+	var msg struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return ""
+	}
+	return msg.Type
+}
+
+// Severities and actions assigned to Deepgram Error events by classifyAgentError.
+const (
+	severityFatal     = "fatal"     // the session cannot continue
+	severityTransient = "transient" // something failed, but the session may recover
+	severityWarning   = "warning"   // informational; nothing failed
+
+	actionStop   = "stop"   // end the session so the browser can start a new one
+	actionIgnore = "ignore" // forward the event and carry on
+)
+
+// classifyAgentError maps a Deepgram Error code to a severity and the action the
+// proxy takes. Unknown codes are treated as transient, since Deepgram closes the
+// socket itself when it cannot continue.
+func classifyAgentError(code string) (severity, action string) {
+	switch code {
+	case "CLIENT_MESSAGE_TIMEOUT":
+		// No audio or KeepAlive arrived in time; Deepgram is ending the session
+		return severityFatal, actionStop
+	case "UNPARSABLE_CLIENT_MESSAGE":
+		// The offending message was dropped; the conversation continues
+		return severityWarning, actionIgnore
+	default:
+		return severityTransient, actionIgnore
+	}
+}
+
+// logAgentProblem logs an Error or Warning event from Deepgram at the level of
+// its severity, and returns the action to take along with the event's code.
+// Warning events are always warnings: they are logged at debug level and ignored.
+func logAgentProblem(sessionID, msgType string, data []byte) (action, code string) {
+	var msg struct {
+		Code        string `json:"code"`
+		Description string `json:"description"`
+	}
+	json.Unmarshal(data, &msg)
+	severity, action := severityWarning, actionIgnore
+	if msgType == msgError {
+		severity, action = classifyAgentError(msg.Code)
+	}
+	if severity == severityWarning {
+		debugf("Deepgram %s (session %s): code=%s description=%q",
+			strings.ToLower(msgType), sessionID, msg.Code, msg.Description)
+	} else {
+		log.Printf("Deepgram %s error (session %s): code=%s description=%q action=%s",
+			severity, sessionID, msg.Code, msg.Description, action)
+	}
+	return action, msg.Code
+}
+
+// latencyTracker measures per-turn agent latency from Deepgram's event stream:
+// the time from UserStartedSpeaking to AgentThinking, and to AgentStartedSpeaking.
+// Turns with a missing or out-of-order event are skipped rather than reported.
+type latencyTracker struct {
+	userStartedAt time.Time
+	thinkingAt    time.Time
+}
+
+// turnLatency is the measured latency of one conversational turn.
+type turnLatency struct {
+	thinking time.Duration // zero when no AgentThinking was seen
+	speaking time.Duration
+}
+
+// event returns the latency message sent to the browser when METRICS_EVENTS is set.
+func (l turnLatency) event() []byte {
+	msg := map[string]interface{}{
+		"type":        msgLatency,
+		"speaking_ms": l.speaking.Milliseconds(),
+	}
+	if l.thinking > 0 {
+		msg["thinking_ms"] = l.thinking.Milliseconds()
+	}
+	data, _ := json.Marshal(msg)
+	return data
+}
+
+// observe records a Deepgram message type. When the agent starts speaking it
+// logs the turn's latency and returns it with ok set.
+func (t *latencyTracker) observe(msgType string) (turn turnLatency, ok bool) {
+	switch msgType {
+	case msgUserStartedSpeaking:
+		t.userStartedAt = time.Now()
+		t.thinkingAt = time.Time{}
+	case msgAgentThinking:
+		if !t.userStartedAt.IsZero() && t.thinkingAt.IsZero() {
+			t.thinkingAt = time.Now()
+		}
+	case msgAgentStartedSpeaking:
+		if t.userStartedAt.IsZero() {
+			return turn, false
+		}
+		turn.speaking = time.Since(t.userStartedAt)
+		if t.thinkingAt.IsZero() {
+			log.Printf("Agent latency: speaking=%dms", turn.speaking.Milliseconds())
+		} else {
+			turn.thinking = t.thinkingAt.Sub(t.userStartedAt)
+			log.Printf("Agent latency: thinking=%dms speaking=%dms",
+				turn.thinking.Milliseconds(), turn.speaking.Milliseconds())
+		}
+		t.userStartedAt = time.Time{}
+		t.thinkingAt = time.Time{}
+		return turn, true
+	}
+	return turn, false
+}
+
 // ============================================================================
 // HTTP HANDLERS
 // ============================================================================
@@ -159,6 +962,18 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// handleVersion reports which build is running.
+// GET /api/version
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"version":   Version,
+		"commit":    Commit,
+		"buildTime": BuildTime,
+		"goVersion": runtime.Version(),
+	})
+}
+
 // handleMetadata returns project metadata from deepgram.toml.
 func handleMetadata(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -194,10 +1009,256 @@ func handleMetadata(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(cfg.Meta)
 }
 
+// requireAdmin wraps an admin handler so it only runs for requests carrying
+// "Authorization: Bearer <ADMIN_TOKEN>".
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(appConfig.adminToken)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":   "UNAUTHORIZED",
+				"message": "Missing or invalid admin token",
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleAdminConnections lists active voice agent connections.
+// GET /api/admin/connections
+func handleAdminConnections(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(listConnections())
+}
+
+// handleAdminStats returns server-wide connection and traffic counters.
+// GET /api/admin/stats
+func handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(statsSnapshot())
+}
+
+// trustedProxyList returns TRUSTED_PROXIES as CIDR strings for the admin config.
+func trustedProxyList() []string {
+	list := []string{}
+	for _, network := range appConfig.trustedProxies {
+		list = append(list, network.String())
+	}
+	return list
+}
+
+// handleAdminConfig returns the active server configuration.
+// Secrets (API key, session secret, admin token) are never included.
+// GET /api/admin/config
+func handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deepgramAgentUrl":    appConfig.deepgramAgentURL,
+		"host":                appConfig.host,
+		"port":                appConfig.port,
+		"allowedOrigins":      appConfig.allowedOrigins,
+		"allowAllOrigins":     appConfig.allowAllOrigins,
+		"trustedProxies":      trustedProxyList(),
+		"maxConnections":      appConfig.maxConnections,
+		"maxMessageBytes":     appConfig.maxMessageBytes,
+		"maxOutboundBytes":    appConfig.maxOutboundBytes,
+		"writeTimeoutSeconds": appConfig.writeTimeout.Seconds(),
+		"inputRateLimitBytes": appConfig.inputRateLimit,
+		"idleTimeoutSeconds":  appConfig.idleTimeout.Seconds(),
+		"connectAttempts":     appConfig.connectAttempts,
+		"singleSession":       appConfig.singleSession,
+		"redactTranscripts":   appConfig.redactTranscripts,
+		"redactPattern":       appConfig.redactPattern,
+		"keepAliveSeconds":    appConfig.keepAliveInterval.Seconds(),
+		"heartbeatSeconds":    appConfig.heartbeatInterval.Seconds(),
+		"metricsEvents":       appConfig.metricsEvents,
+		"debug":               appConfig.debug,
+		"accessLog":           appConfig.accessLog,
+		"audioCoalesceMs":     appConfig.audioCoalesceWindow.Milliseconds(),
+		"audioCoalesceBytes":  appConfig.audioCoalesceBytes,
+	})
+}
+
+// handleAdminInject makes a session's agent speak the given text by sending
+// Deepgram an InjectAgentMessage. If the agent cannot take it (e.g. the user is
+// speaking), Deepgram replies on the session with InjectionRefused, which the
+// browser receives like any other event.
+// POST /api/admin/sessions/{id}/inject  {"content": "..."}
+func handleAdminInject(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Content) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":   "BAD_REQUEST",
+			"message": "Request body must be JSON with a non-empty \"content\" field",
+		})
+		return
+	}
+
+	info := findSession(r.PathValue("id"))
+	if info == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":   "NOT_FOUND",
+			"message": "No active session with that ID",
+		})
+		return
+	}
+
+	msg, _ := json.Marshal(map[string]string{
+		"type":    msgInjectAgentMessage,
+		"message": body.Content,
+	})
+	if err := info.writeToDeepgram(websocket.TextMessage, msg); err != nil {
+		log.Printf("Failed to inject agent message into session %s: %v", info.ID, err)
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":   "CONFLICT",
+			"message": "Session is not connected to Deepgram",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
+}
+
+// handleAdminTranscript returns the conversation transcript of an active session,
+// or of a session that ended within the last transcriptRetention.
+// GET /api/admin/sessions/{id}/transcript
+func handleAdminTranscript(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if info := findSession(id); info != nil {
+		json.NewEncoder(w).Encode(info.transcriptSnapshot())
+		return
+	}
+	if transcript, ok := endedTranscripts.Load(id); ok {
+		json.NewEncoder(w).Encode(transcript)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   "NOT_FOUND",
+		"message": "No active or recent session with that ID",
+	})
+}
+
+// statusRecorder captures the response status for the access log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack lets the WebSocket upgrader take over the connection through the recorder.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// logRequests writes one access log line per request. For WebSocket upgrades
+// the line is written when the session ends, so the duration is the session length.
+// Health checks are only logged when LOG_LEVEL=debug.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !appConfig.accessLog || (r.URL.Path == "/health" && !appConfig.debug) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		log.Printf("method=%s path=%s status=%d duration=%s remote=%s",
+			r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond), clientAddr(r))
+	})
+}
+
+// handleAdminKick ends an active session: the browser receives close code 4403
+// and the session's Deepgram connection is closed.
+// POST /api/admin/sessions/{id}/kick
+func handleAdminKick(w http.ResponseWriter, r *http.Request) {
+	info := findSession(r.PathValue("id"))
+	if info == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":   "NOT_FOUND",
+			"message": "No active session with that ID",
+		})
+		return
+	}
+	info.cancel(errSessionKicked)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
+}
+
+// handleAdminShutdown starts the same graceful shutdown as SIGTERM and returns
+// immediately; teardown continues in the background.
+// POST /api/admin/shutdown
+func handleAdminShutdown(w http.ResponseWriter, r *http.Request) {
+	select {
+	case shutdownRequests <- "Admin shutdown requested":
+		log.Printf("Shutdown requested by %s", clientAddr(r))
+	default:
+		// A shutdown is already in progress
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
+}
+
 // ============================================================================
 // WEBSOCKET PROXY HANDLER
 // ============================================================================
 
+// maxDialBackoff caps the wait between Deepgram connection attempts.
+const maxDialBackoff = 8 * time.Second
+
+// dialDeepgram connects to the Deepgram Agent API, retrying transient failures
+// (network errors and 5xx handshake responses) with exponential backoff.
+// Errors such as an invalid API key are returned immediately, and cancelling
+// ctx (admin kick, shutdown) stops the dial and any backoff wait. onRetry is
+// called with the attempt number before each retry.
+func dialDeepgram(ctx context.Context, onRetry func(attempt int)) (*websocket.Conn, error) {
+	header := http.Header{}
+	header.Set("Authorization", fmt.Sprintf("Token %s", appConfig.deepgramAPIKey))
+
+	backoff := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		conn, resp, err := websocket.DefaultDialer.DialContext(ctx, appConfig.deepgramAgentURL, header)
+		if err == nil {
+			return conn, nil
+		}
+		if resp != nil && resp.StatusCode < http.StatusInternalServerError {
+			return nil, fmt.Errorf("%w (HTTP %d)", err, resp.StatusCode)
+		}
+		if attempt >= appConfig.connectAttempts {
+			return nil, err
+		}
+		log.Printf("Deepgram connection attempt %d/%d failed: %v; retrying in %s",
+			attempt, appConfig.connectAttempts, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+		backoff = min(backoff*2, maxDialBackoff)
+		onRetry(attempt + 1)
+	}
+}
+
 // handleVoiceAgent proxies WebSocket connections to Deepgram's Voice Agent API.
 // It forwards all messages (JSON and binary) bidirectionally without modification.
 func handleVoiceAgent(w http.ResponseWriter, r *http.Request) {
@@ -210,9 +1271,45 @@ func handleVoiceAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Upgrade with the accepted subprotocol echoed back
+	// Browsers cannot read an HTTP error body, so an unsupported version is
+	// refused after the upgrade with a close frame the client can report
+	version, ok := negotiateVersion(protocols)
+	if !ok {
+		log.Printf("WebSocket rejected: unsupported protocol version (offered %v)", protocols)
+		conn, err := upgrader.Upgrade(w, r, http.Header{"Sec-WebSocket-Protocol": {validProto}})
+		if err != nil {
+			log.Printf("WebSocket upgrade failed: %v", err)
+			return
+		}
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(closeUnsupportedVersion,
+				"unsupported protocol version; this server speaks "+protocolVersion),
+			time.Now().Add(controlWriteTimeout))
+		conn.Close()
+		return
+	}
+
+	if shuttingDown.Load() {
+		http.Error(w, "Server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Claim a slot before the handshake so concurrent upgrades cannot overshoot the limit
+	if err := reserveConnection(); err != nil {
+		log.Printf("WARNING: rejecting WebSocket connection: %v (limit %d)", err, appConfig.maxConnections)
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer releaseConnection()
+
+	// Upgrade with the accepted subprotocol echoed back; the protocol version
+	// takes precedence when the client offered one
 	responseHeader := http.Header{}
-	responseHeader.Set("Sec-WebSocket-Protocol", validProto)
+	if version != "" {
+		responseHeader.Set("Sec-WebSocket-Protocol", version)
+	} else {
+		responseHeader.Set("Sec-WebSocket-Protocol", validProto)
+	}
 
 	clientConn, err := upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
@@ -220,30 +1317,97 @@ func handleVoiceAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println("Client connected to /api/voice-agent")
-	activeConnections.Store(clientConn, true)
+	info := newConnInfo(r)
+	info.client = clientConn
+
+	// Cancelling the session context closes the client connection, which unblocks
+	// the read loop and tears the session down like a normal disconnect.
+	ctx, cancel := context.WithCancelCause(context.Background())
+	info.cancel = cancel
+	defer cancel(nil)
+	go func() {
+		<-ctx.Done()
+		if context.Cause(ctx) == errSessionKicked {
+			log.Printf("Session %s ended by admin", info.ID)
+			clientConn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(closeKicked, "Session ended by admin"),
+				time.Now().Add(controlWriteTimeout))
+			clientConn.Close()
+		}
+	}()
+
+	// Complete the close handshake by echoing the client's close frame.
+	// WriteControl is safe to call while the Deepgram goroutine writes data.
+	clientConn.SetCloseHandler(func(code int, text string) error {
+		msg := websocket.FormatCloseMessage(getSafeCloseCode(code), "")
+		err := clientConn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(controlWriteTimeout))
+		if err != nil && err != websocket.ErrCloseSent {
+			return err
+		}
+		return nil
+	})
+
+	activeConnections.Store(clientConn, info)
+	stats.totalConnections.Add(1)
+	log.Printf("Client connected to /api/voice-agent from %s (session %s, %d active)",
+		info.RemoteAddr, info.ID, connectionCount())
+
+	// In single-session mode the newest connection wins; older ones are told
+	// they were superseded and then closed.
+	if appConfig.singleSession {
+		superseded, _ := json.Marshal(map[string]string{"type": msgSuperseded})
+		activeConnections.Range(func(key, value interface{}) bool {
+			if other := value.(*connInfo); other != info {
+				other.writeToClient(websocket.TextMessage, superseded)
+			}
+			return true
+		})
+		if n := closeConnectionsExcept(clientConn, closeSuperseded, "Superseded by a new session"); n > 0 {
+			log.Printf("Single-session mode: closed %d older session(s)", n)
+		}
+	}
+
+	// Bound the size of a single client frame; gorilla closes the connection
+	// with 1009 (message too big) when it is exceeded.
+	clientConn.SetReadLimit(int64(appConfig.maxMessageBytes))
 
 	// Connect to Deepgram Voice Agent API
 	// No query parameters needed -- config is sent via JSON after connection
 	log.Println("Initiating Deepgram connection...")
-	deepgramHeader := http.Header{}
-	deepgramHeader.Set("Authorization", fmt.Sprintf("Token %s", appConfig.deepgramAPIKey))
-
-	deepgramConn, _, err := websocket.DefaultDialer.Dial(appConfig.deepgramAgentURL, deepgramHeader)
+	deepgramConn, err := dialDeepgram(ctx, func(attempt int) {
+		// Let the browser show that the session is still being set up
+		status, _ := json.Marshal(map[string]interface{}{
+			"type":         msgConnecting,
+			"attempt":      attempt,
+			"max_attempts": appConfig.connectAttempts,
+		})
+		info.writeToClient(websocket.TextMessage, status)
+	})
+	if err != nil && ctx.Err() != nil {
+		log.Printf("Deepgram connection aborted: %v", err)
+		clientConn.Close()
+		activeConnections.Delete(clientConn)
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to connect to Deepgram: %v", err)
 		errMsg, _ := json.Marshal(map[string]string{
-			"type":        "Error",
+			"type":        msgError,
 			"description": "Failed to establish proxy connection",
 			"code":        "CONNECTION_FAILED",
 		})
-		clientConn.WriteMessage(websocket.TextMessage, errMsg)
+		if err := info.writeToClient(websocket.TextMessage, errMsg); err != nil {
+			log.Printf("Failed to send connection error to client: %v", err)
+		}
 		clientConn.Close()
 		activeConnections.Delete(clientConn)
 		return
 	}
 
 	log.Println("Connected to Deepgram Agent API")
+	info.deepgramMu.Lock()
+	info.deepgram = deepgramConn
+	info.deepgramMu.Unlock()
 
 	// done channels signal when each forwarding goroutine finishes
 	clientDone := make(chan struct{})
@@ -252,118 +1416,438 @@ func handleVoiceAgent(w http.ResponseWriter, r *http.Request) {
 	// Forward messages: Deepgram -> Client
 	go func() {
 		defer close(deepgramDone)
+
+		// Reads happen in their own goroutine so that the loop below can also
+		// flush coalesced audio when its window expires between frames.
+		messages := make(chan deepgramMessage)
+		go func() {
+			for {
+				messageType, data, err := deepgramConn.ReadMessage()
+				select {
+				case messages <- deepgramMessage{messageType, data, err}:
+				case <-deepgramDone:
+					return
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+
+		// Buffered audio is flushed when its window expires or its size limit is
+		// reached, and always before any JSON message (e.g. AgentAudioDone) so
+		// ordering between audio and events is preserved.
+		var coalescer *audioCoalescer
+		if appConfig.audioCoalesceWindow > 0 {
+			coalescer = &audioCoalescer{
+				window:   appConfig.audioCoalesceWindow,
+				maxBytes: appConfig.audioCoalesceBytes,
+			}
+		}
+		var latency latencyTracker
+		flushAudio := func() error {
+			if coalescer == nil || len(coalescer.buf) == 0 {
+				return nil
+			}
+			return info.forwardToClient(websocket.BinaryMessage, coalescer.take())
+		}
+
 		for {
-			messageType, data, err := deepgramConn.ReadMessage()
+			var msg deepgramMessage
+			select {
+			case <-coalescer.expired():
+				if err := flushAudio(); err != nil {
+					log.Printf("Error forwarding to client: %v", err)
+					return
+				}
+				continue
+			case msg = <-messages:
+			}
+			messageType, data, err := msg.messageType, msg.data, msg.err
 			if err != nil {
-				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-					log.Println("Deepgram connection closed normally")
+				flushAudio()
+				// Forward Deepgram's close code and reason (e.g. auth, quota or idle
+				// errors) so the browser can tell why the session ended. Reserved
+				// codes are translated to 1000.
+				closeCode, reason := websocket.CloseNormalClosure, ""
+				var ce *websocket.CloseError
+				if errors.As(err, &ce) {
+					log.Printf("Deepgram closed the connection: code=%d reason=%q", ce.Code, ce.Text)
+					closeCode, reason = getSafeCloseCode(ce.Code), ce.Text
 				} else {
 					log.Printf("Deepgram read error: %v", err)
 				}
-				// Translate reserved close codes to 1000 before forwarding to client
-				closeCode := websocket.CloseNormalClosure
-				if ce, ok := err.(*websocket.CloseError); ok {
-					closeCode = getSafeCloseCode(ce.Code)
+				info.writeToClient(websocket.CloseMessage,
+					websocket.FormatCloseMessage(closeCode, reason))
+				return
+			}
+			if messageType == websocket.BinaryMessage {
+				info.agentAudioBytes.Add(int64(len(data)))
+			}
+			if coalescer != nil && messageType == websocket.BinaryMessage {
+				if coalescer.add(data) {
+					if err := flushAudio(); err != nil {
+						log.Printf("Error forwarding to client: %v", err)
+						return
+					}
+				}
+				continue
+			}
+			var msgType, stopCode string
+			var turn turnLatency
+			turnDone := false
+			if messageType == websocket.TextMessage {
+				msgType = peekMessageType(data)
+				debugf("Deepgram -> client: %s", msgType)
+				turn, turnDone = latency.observe(msgType)
+				switch msgType {
+				case msgUserStartedSpeaking:
+					// Barge-in: the agent was interrupted, so audio still waiting
+					// to be coalesced is stale and must not reach the browser
+					if coalescer != nil && len(coalescer.buf) > 0 {
+						debugf("Dropping %d bytes of buffered agent audio on barge-in", len(coalescer.take()))
+					}
+					// Deepgram may not send AgentAudioDone for an interrupted response
+					atomic.StoreInt32(&info.agentSpeaking, 0)
+				case msgAgentStartedSpeaking:
+					atomic.StoreInt32(&info.agentSpeaking, 1)
+				case msgAgentAudioDone:
+					atomic.StoreInt32(&info.agentSpeaking, 0)
+				case msgConversationText:
+					// Only kept when the admin API that serves it is enabled
+					if appConfig.adminToken != "" {
+						info.recordTranscript(data)
+					}
+				case msgError, msgWarning:
+					if action, code := logAgentProblem(info.ID, msgType, data); action == actionStop {
+						stopCode = code
+					}
 				}
-				clientConn.WriteMessage(websocket.CloseMessage,
-					websocket.FormatCloseMessage(closeCode, ""))
+			}
+			if err := flushAudio(); err != nil {
+				log.Printf("Error forwarding to client: %v", err)
 				return
 			}
-			if err := clientConn.WriteMessage(messageType, data); err != nil {
+			if err := info.forwardToClient(messageType, data); err != nil {
 				log.Printf("Error forwarding to client: %v", err)
 				return
 			}
+			if stopCode != "" {
+				// The error itself has been forwarded; end the session with its code as the reason
+				info.writeToClient(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, stopCode))
+				return
+			}
+			if turnDone && appConfig.metricsEvents {
+				if err := info.writeToClient(websocket.TextMessage, turn.event()); err != nil {
+					log.Printf("Error sending latency to client: %v", err)
+					return
+				}
+			}
+			if appConfig.metricsEvents && msgType == msgAgentAudioDone {
+				total, _ := json.Marshal(map[string]interface{}{
+					"type":  msgAudioBytes,
+					"total": info.agentAudioBytes.Load(),
+				})
+				if err := info.writeToClient(websocket.TextMessage, total); err != nil {
+					log.Printf("Error sending agent audio total to client: %v", err)
+					return
+				}
+			}
 		}
 	}()
 
 	// Forward messages: Client -> Deepgram
 	go func() {
 		defer close(clientDone)
+
+		// Throttle (rather than drop) audio that arrives faster than the
+		// configured rate; blocking here pushes back on the client's socket.
+		var limiter *tokenBucket
+		if appConfig.inputRateLimit > 0 {
+			limiter = newTokenBucket(appConfig.inputRateLimit)
+		}
+		throttled := false
+		muted := false
+		var lastKeepAlive time.Time
+
 		for {
+			// Any message from the client (audio or JSON) counts as activity
+			if appConfig.idleTimeout > 0 {
+				clientConn.SetReadDeadline(time.Now().Add(appConfig.idleTimeout))
+			}
 			messageType, data, err := clientConn.ReadMessage()
 			if err != nil {
-				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-					log.Println("Client disconnected normally")
+				reason := disconnectReason(err)
+				if reason == reasonReadError {
+					log.Printf("Client disconnected (session %s): %s: %v", info.ID, reason, err)
 				} else {
-					log.Printf("Client read error: %v", err)
+					log.Printf("Client disconnected (session %s): %s", info.ID, reason)
 				}
-				// Complete the close handshake by replying with a close frame
-				closeCode := websocket.CloseNormalClosure
-				if ce, ok := err.(*websocket.CloseError); ok {
-					closeCode = getSafeCloseCode(ce.Code)
+				switch reason {
+				case reasonReadTimeout:
+					log.Printf("Client idle for %s, closing session", appConfig.idleTimeout)
+					clientConn.WriteControl(websocket.CloseMessage,
+						websocket.FormatCloseMessage(closeIdleTimeout, "Idle timeout"),
+						time.Now().Add(controlWriteTimeout))
+				case reasonMessageTooBig:
+					log.Printf("Client message exceeded %d bytes", appConfig.maxMessageBytes)
 				}
-				clientConn.WriteMessage(websocket.CloseMessage,
-					websocket.FormatCloseMessage(closeCode, ""))
 				return
 			}
-			if err := deepgramConn.WriteMessage(messageType, data); err != nil {
+			if messageType == websocket.TextMessage {
+				// Proxy control messages are handled here and never reach Deepgram
+				switch msgType := peekMessageType(data); msgType {
+				case msgKeepalive:
+					continue
+				case msgMute, msgUnmute:
+					muted = msgType == msgMute
+					log.Printf("Session %s %sd", info.ID, msgType)
+					state, _ := json.Marshal(map[string]interface{}{
+						"type":  msgMuteState,
+						"muted": muted,
+					})
+					if err := info.writeToClient(websocket.TextMessage, state); err != nil {
+						log.Printf("Error sending mute state to client: %v", err)
+						return
+					}
+					continue
+				default:
+					debugf("Client -> Deepgram: %s", msgType)
+				}
+			} else if muted {
+				// Drop microphone audio while the client is muted, but keep the
+				// Deepgram session from timing out for lack of input
+				if time.Since(lastKeepAlive) < mutedKeepAliveInterval {
+					continue
+				}
+				lastKeepAlive = time.Now()
+				messageType, data = websocket.TextMessage, []byte(`{"type":"`+msgAgentKeepAlive+`"}`)
+			}
+			if limiter != nil && messageType == websocket.BinaryMessage {
+				if delay := limiter.take(len(data)); delay > 0 {
+					if !throttled {
+						log.Printf("WARNING: client audio exceeds %d bytes/s, throttling", appConfig.inputRateLimit)
+						throttled = true
+					}
+					select {
+					case <-time.After(delay):
+					case <-deepgramDone:
+						return
+					}
+				} else {
+					throttled = false
+				}
+			}
+			if err := info.writeToDeepgram(messageType, data); err != nil {
 				log.Printf("Error forwarding to Deepgram: %v", err)
 				return
 			}
 		}
 	}()
 
+	// Ping the client while the session is open. Pings are WebSocket control
+	// frames, so the browser answers them without seeing any extra messages.
+	// They only keep the browser leg alive: application-level KeepAlive messages
+	// for the Deepgram leg come from the frontend and are forwarded unchanged
+	// (the proxy only sends its own while the client is muted).
+	if appConfig.keepAliveInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(appConfig.keepAliveInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := clientConn.WriteControl(websocket.PingMessage, nil,
+						time.Now().Add(controlWriteTimeout)); err != nil {
+						log.Printf("Keepalive ping failed: %v", err)
+						return
+					}
+				case <-clientDone:
+					return
+				case <-deepgramDone:
+					return
+				}
+			}
+		}()
+	}
+
+	// Send the server clock to the browser so it can estimate clock offset
+	// when displaying latencies.
+	if appConfig.heartbeatInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(appConfig.heartbeatInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					heartbeat, _ := json.Marshal(map[string]interface{}{
+						"type":           msgHeartbeat,
+						"server_time_ms": time.Now().UnixMilli(),
+					})
+					if err := info.writeToClient(websocket.TextMessage, heartbeat); err != nil {
+						return
+					}
+				case <-clientDone:
+					return
+				case <-deepgramDone:
+					return
+				}
+			}
+		}()
+	}
+
 	// Wait for either side to close, then clean up both
 	select {
 	case <-clientDone:
 		log.Println("Client disconnected, closing Deepgram connection")
-		deepgramConn.WriteMessage(websocket.CloseMessage,
+		info.writeToDeepgram(websocket.CloseMessage,
 			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Client disconnected"))
 		deepgramConn.Close()
 		clientConn.Close()
 	case <-deepgramDone:
-		log.Println("Deepgram disconnected, closing client connection")
+		// Deepgram closed, or writing to the client failed (e.g. a write timeout).
+		// Close the upstream session too so it is not left open and billed.
+		log.Println("Deepgram forwarding ended, closing both connections")
+		info.writeToDeepgram(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Client connection closed"))
+		deepgramConn.Close()
 		clientConn.Close()
 	}
+	// Both sockets are closed now, so the other forwarding goroutine exits promptly
+	<-clientDone
+	<-deepgramDone
 
+	// Retain the transcript first so it stays readable while the session is removed
+	if appConfig.adminToken != "" {
+		info.retainTranscript()
+	}
 	activeConnections.Delete(clientConn)
+	log.Printf("Session ended after %s, %d bytes of agent audio",
+		time.Since(info.ConnectedAt).Round(time.Second), info.agentAudioBytes.Load())
 }
 
 // ============================================================================
 // GRACEFUL SHUTDOWN
 // ============================================================================
 
-// gracefulShutdown closes all active connections and stops the server.
-func gracefulShutdown(server *http.Server, sig string) {
-	log.Printf("\n%s signal received: starting graceful shutdown...", sig)
+// shutdownDrainTimeout bounds how long shutdown waits for in-flight agent audio.
+const shutdownDrainTimeout = 5 * time.Second
+
+// closeAllConnections sends a close frame with the given code and reason to every
+// active client connection, closes it, and removes it from activeConnections.
+// Returns the number of connections closed.
+func closeAllConnections(code int, reason string) int {
+	return closeConnectionsExcept(nil, code, reason)
+}
 
-	// Close all active WebSocket connections
+// closeConnectionsExcept is closeAllConnections but leaves keep open.
+func closeConnectionsExcept(keep *websocket.Conn, code int, reason string) int {
 	count := 0
 	activeConnections.Range(func(key, value interface{}) bool {
 		conn := key.(*websocket.Conn)
-		conn.WriteMessage(websocket.CloseMessage,
-			websocket.FormatCloseMessage(websocket.CloseGoingAway, "Server shutting down"))
+		if conn == keep {
+			return true
+		}
+		// Also stops a session that is still dialing Deepgram
+		value.(*connInfo).cancel(errSessionClosed)
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, reason), time.Now().Add(controlWriteTimeout))
 		conn.Close()
+		activeConnections.Delete(conn)
 		count++
 		return true
 	})
-	log.Printf("Closed %d active WebSocket connection(s)", count)
+	return count
+}
 
-	// Shutdown HTTP server with a 10-second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// shutdownRequests lets HTTP handlers ask main to run gracefulShutdown.
+var shutdownRequests = make(chan string, 1)
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("HTTP server shutdown error: %v", err)
-	}
+// shuttingDown is set when graceful shutdown starts, so that no new voice
+// sessions are accepted while in-flight agent audio drains.
+var shuttingDown atomic.Bool
+
+// shutdownOnce makes gracefulShutdown idempotent when several triggers fire at once.
+var shutdownOnce sync.Once
+
+// gracefulShutdown closes all active connections and stops the server.
+// It is safe to call concurrently; only the first call runs the teardown and
+// later callers return once it has finished.
+func gracefulShutdown(server *http.Server, reason string) {
+	shutdownOnce.Do(func() {
+		log.Printf("\n%s: starting graceful shutdown...", reason)
+		shuttingDown.Store(true)
+		server.SetKeepAlivesEnabled(false)
+
+		// Let agents that are mid-utterance finish so their last response reaches the browser
+		deadline := time.Now().Add(shutdownDrainTimeout)
+		for agentsSpeaking() > 0 && time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if n := agentsSpeaking(); n > 0 {
+			log.Printf("Drain timeout: %d agent(s) still speaking", n)
+		}
+
+		// Close all active WebSocket connections
+		count := closeAllConnections(websocket.CloseGoingAway, "Server shutting down")
+		log.Printf("Closed %d active WebSocket connection(s)", count)
 
-	log.Println("Shutdown complete")
+		// Shutdown HTTP server with a 10-second timeout
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("HTTP server shutdown error: %v", err)
+		}
+
+		log.Println("Shutdown complete")
+	})
 }
 
 // ============================================================================
 // MAIN
 // ============================================================================
 
-func main() {
-	// Load configuration from environment variables
+// loadConfig reads the configuration from environment variables into appConfig.
+// It returns an error naming the setting when one is missing or invalid.
+func loadConfig() error {
+	var intErr error
+	envInt := func(name string, def int) int {
+		n, err := getEnvInt(name, def)
+		if intErr == nil {
+			intErr = err
+		}
+		return n
+	}
+
+	switch level := strings.ToLower(os.Getenv("LOG_LEVEL")); level {
+	case "", "info":
+	case "debug":
+		appConfig.debug = true
+	default:
+		log.Printf("WARNING: unknown LOG_LEVEL %q, using info", level)
+	}
+
+	appConfig.accessLog = os.Getenv("ACCESS_LOG") != "false"
+
 	appConfig.deepgramAPIKey = os.Getenv("DEEPGRAM_API_KEY")
 	if appConfig.deepgramAPIKey == "" {
-		log.Fatal("ERROR: DEEPGRAM_API_KEY environment variable is required\n" +
+		return errors.New("DEEPGRAM_API_KEY environment variable is required\n" +
 			"Please copy sample.env to .env and add your API key")
 	}
 
-	// Voice Agent uses agent.deepgram.com, not api.deepgram.com
+	// Voice Agent uses agent.deepgram.com, not api.deepgram.com.
+	// DEEPGRAM_ENDPOINT overrides it for self-hosted, staging or local test servers.
 	appConfig.deepgramAgentURL = "wss://agent.deepgram.com/v1/agent/converse"
+	if endpoint := os.Getenv("DEEPGRAM_ENDPOINT"); endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			return fmt.Errorf("DEEPGRAM_ENDPOINT must be a ws:// or wss:// URL, got %q", endpoint)
+		}
+		appConfig.deepgramAgentURL = endpoint
+		log.Printf("Using Deepgram endpoint %s", endpoint)
+	}
 
 	appConfig.port = os.Getenv("PORT")
 	if appConfig.port == "" {
@@ -375,27 +1859,135 @@ func main() {
 		appConfig.host = "0.0.0.0"
 	}
 
+	appConfig.adminToken = os.Getenv("ADMIN_TOKEN")
+
+	// Optional TLS termination for deployments without a reverse proxy
+	appConfig.tlsCertFile = os.Getenv("TLS_CERT_FILE")
+	appConfig.tlsKeyFile = os.Getenv("TLS_KEY_FILE")
+	if (appConfig.tlsCertFile == "") != (appConfig.tlsKeyFile == "") {
+		return errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if appConfig.tlsCertFile != "" {
+		if _, err := tls.LoadX509KeyPair(appConfig.tlsCertFile, appConfig.tlsKeyFile); err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %v", err)
+		}
+	}
+
 	secret := os.Getenv("SESSION_SECRET")
 	if secret != "" {
 		appConfig.sessionSecret = []byte(secret)
 	} else {
 		appConfig.sessionSecret = make([]byte, 32)
 		if _, err := rand.Read(appConfig.sessionSecret); err != nil {
-			log.Fatal("Failed to generate session secret:", err)
+			return fmt.Errorf("failed to generate session secret: %w", err)
+		}
+	}
+
+	appConfig.maxConnections = envInt("MAX_CONNECTIONS", 100)
+
+	appConfig.maxMessageBytes = envInt("MAX_MESSAGE_BYTES", 1<<20)
+	appConfig.maxOutboundBytes = envInt("MAX_OUTBOUND_MESSAGE_BYTES", 0)
+	appConfig.writeTimeout = time.Duration(envInt("WRITE_TIMEOUT_SECONDS", 10)) * time.Second
+
+	appConfig.inputRateLimit = envInt("INPUT_RATE_LIMIT_BYTES", 0)
+	appConfig.connectAttempts = max(1, envInt("DEEPGRAM_CONNECT_ATTEMPTS", 3))
+	appConfig.idleTimeout = time.Duration(envInt("IDLE_TIMEOUT_SECONDS", 0)) * time.Second
+	appConfig.singleSession = os.Getenv("SINGLE_SESSION") == "true"
+	appConfig.redactTranscripts = os.Getenv("REDACT_TRANSCRIPTS") == "true"
+	if pattern := os.Getenv("REDACT_PATTERN"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("REDACT_PATTERN is not a valid regular expression: %v", err)
+		}
+		appConfig.redactPattern = pattern
+		redactions = append(redactions, redaction{re, "[REDACTED]"})
+	}
+	appConfig.keepAliveInterval = time.Duration(envInt("KEEPALIVE_INTERVAL_SECONDS", 30)) * time.Second
+	appConfig.heartbeatInterval = time.Duration(envInt("HEARTBEAT_INTERVAL_SECONDS", 0)) * time.Second
+	appConfig.metricsEvents = os.Getenv("METRICS_EVENTS") == "true"
+
+	appConfig.audioCoalesceWindow = time.Duration(envInt("AUDIO_COALESCE_MS", 0)) * time.Millisecond
+	appConfig.audioCoalesceBytes = envInt("AUDIO_COALESCE_BYTES", 32768)
+
+	appConfig.allowedOrigins = nil
+	origins := os.Getenv("ALLOWED_ORIGINS")
+	if origins == "" {
+		origins = defaultAllowedOrigins
+	}
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			appConfig.allowedOrigins = append(appConfig.allowedOrigins, strings.TrimSuffix(origin, "/"))
 		}
 	}
+	appConfig.allowAllOrigins = os.Getenv("ALLOW_ALL_ORIGINS") == "true"
+	if appConfig.allowAllOrigins {
+		log.Println("WARNING: ALLOW_ALL_ORIGINS is enabled; WebSocket origin checks are disabled")
+	}
+
+	if list := os.Getenv("TRUSTED_PROXIES"); list != "" {
+		networks, err := parseTrustedProxies(list)
+		if err != nil {
+			return fmt.Errorf("TRUSTED_PROXIES must list IP addresses or CIDR ranges: %v", err)
+		}
+		appConfig.trustedProxies = networks
+	}
+
+	return intErr
+}
+
+// validateMetadata checks that a deepgram.toml file parses and has a [meta] section.
+func validateMetadata(path string) error {
+	var cfg DeepgramToml
+	if _, err := toml.DecodeFile(path, &cfg); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if cfg.Meta == nil {
+		return fmt.Errorf("missing [meta] section in %s", path)
+	}
+	return nil
+}
+
+func main() {
+	validateOnly := flag.Bool("validate", false, "validate configuration and exit without starting the server")
+	flag.Parse()
+	if os.Getenv("VALIDATE_ONLY") == "true" {
+		*validateOnly = true
+	}
+
+	if err := loadConfig(); err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+
+	// In validate mode, stop once configuration and deepgram.toml have been checked
+	if *validateOnly {
+		if err := validateMetadata("deepgram.toml"); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		log.Println("Configuration is valid")
+		return
+	}
 
 	// Register HTTP and WebSocket routes
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/session", handleSession)
 	mux.HandleFunc("/api/metadata", handleMetadata)
+	mux.HandleFunc("GET /api/version", handleVersion)
 	mux.HandleFunc("/health", handleHealth)
 	mux.HandleFunc("/api/voice-agent", handleVoiceAgent)
+	if appConfig.adminToken != "" {
+		mux.HandleFunc("/api/admin/connections", requireAdmin(handleAdminConnections))
+		mux.HandleFunc("/api/admin/config", requireAdmin(handleAdminConfig))
+		mux.HandleFunc("/api/admin/stats", requireAdmin(handleAdminStats))
+		mux.HandleFunc("POST /api/admin/sessions/{id}/inject", requireAdmin(handleAdminInject))
+		mux.HandleFunc("GET /api/admin/sessions/{id}/transcript", requireAdmin(handleAdminTranscript))
+		mux.HandleFunc("POST /api/admin/sessions/{id}/kick", requireAdmin(handleAdminKick))
+		mux.HandleFunc("POST /api/admin/shutdown", requireAdmin(handleAdminShutdown))
+	}
 
 	addr := fmt.Sprintf("%s:%s", appConfig.host, appConfig.port)
 	server := &http.Server{
 		Addr:    addr,
-		Handler: mux,
+		Handler: logRequests(mux),
 	}
 
 	// Handle shutdown signals
@@ -403,22 +1995,48 @@ func main() {
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
 
 	go func() {
-		sig := <-sigChan
-		gracefulShutdown(server, sig.String())
+		var reason string
+		select {
+		case sig := <-sigChan:
+			reason = sig.String() + " signal received"
+		case reason = <-shutdownRequests:
+		}
+		gracefulShutdown(server, reason)
 		os.Exit(0)
 	}()
 
+	scheme, wsScheme := "http", "ws"
+	if appConfig.tlsCertFile != "" {
+		scheme, wsScheme = "https", "wss"
+	}
+
 	// Start server
 	log.Println(strings.Repeat("=", 70))
-	log.Printf("Backend API Server running at http://localhost:%s", appConfig.port)
+	log.Printf("Backend API Server running at %s://localhost:%s", scheme, appConfig.port)
 	log.Println("")
 	log.Println("GET  /api/session")
-	log.Println("WS   /api/voice-agent (auth required)")
+	log.Printf("WS   %s://localhost:%s/api/voice-agent (auth required)", wsScheme, appConfig.port)
 	log.Println("GET  /api/metadata")
+	log.Println("GET  /api/version")
 	log.Println("GET  /health")
+	if appConfig.adminToken != "" {
+		log.Println("GET  /api/admin/connections (admin token required)")
+		log.Println("GET  /api/admin/config (admin token required)")
+		log.Println("GET  /api/admin/stats (admin token required)")
+		log.Println("POST /api/admin/sessions/{id}/inject (admin token required)")
+		log.Println("GET  /api/admin/sessions/{id}/transcript (admin token required)")
+		log.Println("POST /api/admin/sessions/{id}/kick (admin token required)")
+		log.Println("POST /api/admin/shutdown (admin token required)")
+	}
 	log.Println(strings.Repeat("=", 70))
 
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	var err error
+	if appConfig.tlsCertFile != "" {
+		err = server.ListenAndServeTLS(appConfig.tlsCertFile, appConfig.tlsKeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server error: %v", err)
 	}
 }
@@ -0,0 +1,1360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestMain silences the server's logging unless tests run with -v.
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// withConfig restores appConfig when the test ends, so tests can change it freely.
+func withConfig(t *testing.T) {
+	t.Helper()
+	saved := appConfig
+	t.Cleanup(func() { appConfig = saved })
+}
+
+// newConnPair returns both ends of a WebSocket connection over a test server.
+func newConnPair(t *testing.T) (server, client *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	server = <-conns
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return server, client
+}
+
+func TestCheckOrigin(t *testing.T) {
+	withConfig(t)
+	appConfig.allowedOrigins = []string{"http://localhost:8080"}
+
+	tests := []struct {
+		name     string
+		origin   string
+		host     string
+		allowAll bool
+		want     bool
+	}{
+		{"allowed", "http://localhost:8080", "localhost:8081", false, true},
+		{"allowed, different case", "HTTP://LOCALHOST:8080", "localhost:8081", false, true},
+		{"disallowed", "https://evil.example", "localhost:8081", false, false},
+		{"missing", "", "localhost:8081", false, true},
+		{"same host", "https://voice.example.com", "voice.example.com", false, true},
+		{"allow all", "https://evil.example", "localhost:8081", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig.allowAllOrigins = tt.allowAll
+			r := httptest.NewRequest(http.MethodGet, "/api/voice-agent", nil)
+			r.Host = tt.host
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := checkOrigin(r); got != tt.want {
+				t.Errorf("checkOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(1000)
+	if delay := b.take(1000); delay != 0 {
+		t.Errorf("full bucket: delay = %s, want 0", delay)
+	}
+	// The bucket is empty, so 500 more bytes cost half a second (less the
+	// negligible refill since the previous take)
+	delay := b.take(500)
+	if delay <= 400*time.Millisecond || delay > 500*time.Millisecond {
+		t.Errorf("empty bucket: delay = %s, want about 500ms", delay)
+	}
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		protocols   []string
+		wantVersion string
+		wantOK      bool
+	}{
+		{"none offered", []string{"access_token.x"}, "", true},
+		{"supported", []string{"access_token.x", "voiceagent.v1"}, "voiceagent.v1", true},
+		{"unsupported", []string{"access_token.x", "voiceagent.v2"}, "", false},
+		{"supported among others", []string{"voiceagent.v2", "voiceagent.v1"}, "voiceagent.v1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, ok := negotiateVersion(tt.protocols)
+			if version != tt.wantVersion || ok != tt.wantOK {
+				t.Errorf("negotiateVersion(%v) = %q, %v; want %q, %v",
+					tt.protocols, version, ok, tt.wantVersion, tt.wantOK)
+			}
+		})
+	}
+}
+
+// timeoutError is a net.Error that reports a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestDisconnectReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&websocket.CloseError{Code: websocket.CloseNormalClosure}, reasonNormal},
+		{&websocket.CloseError{Code: websocket.CloseGoingAway}, reasonGoingAway},
+		{&websocket.CloseError{Code: websocket.CloseNoStatusReceived}, reasonNoStatus},
+		{&websocket.CloseError{Code: websocket.CloseAbnormalClosure}, reasonAbnormal},
+		{&websocket.CloseError{Code: websocket.CloseInvalidFramePayloadData}, reasonProtocolError},
+		{websocket.ErrReadLimit, reasonMessageTooBig},
+		{timeoutError{}, reasonReadTimeout},
+		{io.ErrUnexpectedEOF, reasonReadError},
+	}
+	for _, tt := range tests {
+		if got := disconnectReason(tt.err); got != tt.want {
+			t.Errorf("disconnectReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestLatencyTrackerOutOfOrder(t *testing.T) {
+	var tracker latencyTracker
+
+	// Events before UserStartedSpeaking do not start or complete a turn
+	tracker.observe(msgAgentThinking)
+	if _, ok := tracker.observe(msgAgentStartedSpeaking); ok {
+		t.Fatal("AgentStartedSpeaking without UserStartedSpeaking reported a turn")
+	}
+
+	// A repeated AgentThinking keeps the first timestamp
+	tracker.observe(msgUserStartedSpeaking)
+	tracker.observe(msgAgentThinking)
+	first := tracker.thinkingAt
+	tracker.observe(msgAgentThinking)
+	if tracker.thinkingAt != first {
+		t.Errorf("second AgentThinking moved thinkingAt")
+	}
+
+	turn, ok := tracker.observe(msgAgentStartedSpeaking)
+	if !ok || turn.thinking < 0 || turn.speaking < turn.thinking {
+		t.Fatalf("observe(AgentStartedSpeaking) = %+v, %v", turn, ok)
+	}
+
+	// The turn is complete, so a second AgentStartedSpeaking is not reported
+	if _, ok := tracker.observe(msgAgentStartedSpeaking); ok {
+		t.Error("tracker reported the same turn twice")
+	}
+}
+
+func TestTurnLatencyEvent(t *testing.T) {
+	got := string(turnLatency{speaking: 900 * time.Millisecond}.event())
+	if want := `{"speaking_ms":900,"type":"latency"}`; got != want {
+		t.Errorf("without thinking: got %s, want %s", got, want)
+	}
+	got = string(turnLatency{thinking: 400 * time.Millisecond, speaking: 900 * time.Millisecond}.event())
+	if want := `{"speaking_ms":900,"thinking_ms":400,"type":"latency"}`; got != want {
+		t.Errorf("with thinking: got %s, want %s", got, want)
+	}
+}
+
+func TestForwardToClient(t *testing.T) {
+	withConfig(t)
+	appConfig.maxOutboundBytes = 5
+	appConfig.writeTimeout = time.Second
+
+	server, client := newConnPair(t)
+	info := &connInfo{ID: "test", client: server}
+
+	// Audio is split on even boundaries; oversized JSON is dropped
+	if err := info.forwardToClient(websocket.BinaryMessage, []byte("0123456789a")); err != nil {
+		t.Fatalf("forward audio: %v", err)
+	}
+	if err := info.forwardToClient(websocket.TextMessage, []byte(`{"type":"ConversationText"}`)); err != nil {
+		t.Fatalf("forward oversized text: %v", err)
+	}
+	if err := info.forwardToClient(websocket.TextMessage, []byte(`{}`)); err != nil {
+		t.Fatalf("forward text: %v", err)
+	}
+
+	want := []struct {
+		messageType int
+		data        string
+	}{
+		{websocket.BinaryMessage, "0123"},
+		{websocket.BinaryMessage, "4567"},
+		{websocket.BinaryMessage, "89a"},
+		{websocket.TextMessage, "{}"},
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	for _, w := range want {
+		messageType, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if messageType != w.messageType || string(data) != w.data {
+			t.Errorf("got (%d, %q), want (%d, %q)", messageType, data, w.messageType, w.data)
+		}
+	}
+}
+
+func TestAudioCoalescerSizeFlush(t *testing.T) {
+	c := &audioCoalescer{window: time.Hour, maxBytes: 4}
+	if c.add([]byte("ab")) {
+		t.Fatal("flush requested below maxBytes")
+	}
+	if !c.add([]byte("cd")) {
+		t.Fatal("no flush requested at maxBytes")
+	}
+	if got := string(c.take()); got != "abcd" {
+		t.Errorf("take() = %q, want %q", got, "abcd")
+	}
+	if c.expired() != nil {
+		t.Error("window timer still running after take")
+	}
+}
+
+func TestAudioCoalescerWindowFlush(t *testing.T) {
+	var none *audioCoalescer
+	if none.expired() != nil {
+		t.Fatal("a nil coalescer must never expire")
+	}
+
+	c := &audioCoalescer{window: 20 * time.Millisecond, maxBytes: 1 << 20}
+	if c.expired() != nil {
+		t.Fatal("empty buffer has a window timer")
+	}
+	c.add([]byte("ab"))
+	select {
+	case <-c.expired():
+	case <-time.After(time.Second):
+		t.Fatal("window did not expire")
+	}
+	if got := string(c.take()); got != "ab" {
+		t.Errorf("take() = %q, want %q", got, "ab")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"mail me at bob.smith@example.com ok", "mail me at [EMAIL] ok"},
+		{"call (555) 123-4567 or +1 555.123.4567", "call [PHONE] or [PHONE]"},
+		{"card 4111 1111 1111 1111 thanks", "card [CARD] thanks"},
+		{"card 4111-1111-1111-1111", "card [CARD]"},
+		// Ordinary numbers and text are untouched
+		{"it costs 1500 dollars in 2024, room 12", "it costs 1500 dollars in 2024, room 12"},
+		{"Hello! How can I help you today?", "Hello! How can I help you today?"},
+	}
+	for _, tt := range tests {
+		if got := redact(tt.in); got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRecordTranscriptRedacts(t *testing.T) {
+	withConfig(t)
+	saved := redactions
+	t.Cleanup(func() { redactions = saved })
+	redactions = append(redactions, redaction{regexp.MustCompile(`ACCT-\d{6}`), "[REDACTED]"})
+
+	info := &connInfo{}
+	msg := []byte(`{"type":"ConversationText","role":"user","content":"I am bob@example.com, account ACCT-123456"}`)
+
+	info.recordTranscript(msg)
+	appConfig.redactTranscripts = true
+	info.recordTranscript(msg)
+
+	transcript := info.transcriptSnapshot()
+	if want := "I am bob@example.com, account ACCT-123456"; transcript[0].Content != want {
+		t.Errorf("redaction off: got %q, want %q", transcript[0].Content, want)
+	}
+	if want := "I am [EMAIL], account [REDACTED]"; transcript[1].Content != want {
+		t.Errorf("redaction on: got %q, want %q", transcript[1].Content, want)
+	}
+}
+
+func TestReserveConnection(t *testing.T) {
+	withConfig(t)
+	appConfig.maxConnections = int(reservedConnections.Load()) + 2
+
+	for i := 0; i < 2; i++ {
+		if err := reserveConnection(); err != nil {
+			t.Fatalf("reservation %d: %v", i+1, err)
+		}
+		defer releaseConnection()
+	}
+	if err := reserveConnection(); !errors.Is(err, errTooManyConnections) {
+		t.Fatalf("reservation over the limit: err = %v, want errTooManyConnections", err)
+	}
+	if got := reservedConnections.Load(); got != int64(appConfig.maxConnections) {
+		t.Errorf("a rejected reservation leaked a slot: %d reserved, limit %d", got, appConfig.maxConnections)
+	}
+
+	// Zero disables the limit
+	appConfig.maxConnections = 0
+	if err := reserveConnection(); err != nil {
+		t.Fatalf("reservation without a limit: %v", err)
+	}
+	releaseConnection()
+}
+
+// fakeDeepgram is an in-memory stand-in for the Deepgram Agent API. It greets
+// each connection with Welcome, answers Settings with SettingsApplied, echoes
+// audio back as agent audio and answers InjectAgentMessage with an assistant
+// ConversationText. The type of every JSON message it receives is put on
+// received. Tests can also send their own events with send.
+type fakeDeepgram struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	conn *websocket.Conn // most recent connection; writes are serialized by mu
+
+	connected chan struct{} // receives once per accepted connection
+	closed    chan int      // close code of each connection the proxy closed
+	received  chan string   // type of each JSON message from the proxy
+}
+
+func newFakeDeepgram(t *testing.T) *fakeDeepgram {
+	t.Helper()
+	f := &fakeDeepgram{
+		connected: make(chan struct{}, 10),
+		closed:    make(chan int, 10),
+		received:  make(chan string, 100),
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeDeepgram) serve(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	f.mu.Lock()
+	f.conn = conn
+	f.mu.Unlock()
+	f.send(websocket.TextMessage, `{"type":"Welcome","request_id":"fake"}`)
+	f.connected <- struct{}{}
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			var ce *websocket.CloseError
+			if errors.As(err, &ce) {
+				f.closed <- ce.Code
+			} else {
+				f.closed <- websocket.CloseAbnormalClosure
+			}
+			return
+		}
+		if messageType == websocket.BinaryMessage {
+			f.send(websocket.BinaryMessage, string(data))
+			continue
+		}
+		msgType := peekMessageType(data)
+		f.received <- msgType
+		switch msgType {
+		case "Settings":
+			f.send(websocket.TextMessage, `{"type":"SettingsApplied"}`)
+		case msgInjectAgentMessage:
+			var inject struct {
+				Message string `json:"message"`
+			}
+			json.Unmarshal(data, &inject)
+			reply, _ := json.Marshal(map[string]string{
+				"type":    msgConversationText,
+				"role":    "assistant",
+				"content": inject.Message,
+			})
+			f.send(websocket.TextMessage, string(reply))
+		}
+	}
+}
+
+// send writes a message to the most recent proxy connection. Writes give up
+// after a second so a proxy that stopped reading cannot hang the test.
+func (f *fakeDeepgram) send(messageType int, data string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	f.conn.WriteMessage(messageType, []byte(data))
+}
+
+// startProxy serves handleVoiceAgent against a fake Deepgram and returns the fake
+// and a function that opens an authenticated browser connection to the proxy,
+// optionally offering extra subprotocols, and reads the fake's Welcome.
+func startProxy(t *testing.T) (*fakeDeepgram, func(protocols ...string) *websocket.Conn) {
+	t.Helper()
+	withConfig(t)
+	fake := newFakeDeepgram(t)
+	appConfig.deepgramAPIKey = "test-key"
+	appConfig.deepgramAgentURL = "ws" + strings.TrimPrefix(fake.URL, "http")
+	appConfig.sessionSecret = []byte("test-secret")
+	appConfig.maxConnections = 10
+	appConfig.maxMessageBytes = 1 << 20
+	appConfig.writeTimeout = time.Second
+	appConfig.connectAttempts = 1
+
+	// Sessions must end before withConfig restores appConfig
+	var sessions sync.WaitGroup
+	t.Cleanup(sessions.Wait)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessions.Add(1)
+		defer sessions.Done()
+		handleVoiceAgent(w, r)
+	}))
+	t.Cleanup(proxy.Close)
+
+	dial := func(protocols ...string) *websocket.Conn {
+		t.Helper()
+		conn := dialProxy(t, proxy.URL, protocols...)
+		<-fake.connected
+		expectText(t, conn, "Welcome")
+		return conn
+	}
+	return fake, dial
+}
+
+// dialProxy opens an authenticated browser connection to the proxy at url,
+// offering protocols after the access_token subprotocol.
+func dialProxy(t *testing.T, url string, protocols ...string) *websocket.Conn {
+	t.Helper()
+	token, err := issueToken(appConfig.sessionSecret)
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+	dialer := websocket.Dialer{Subprotocols: append([]string{"access_token." + token}, protocols...)}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readMessage reads the next message, failing the test if none arrives within a second.
+func readMessage(t *testing.T, conn *websocket.Conn) (int, []byte) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return messageType, data
+}
+
+// expectText reads the next message and checks that it is JSON of the given type.
+func expectText(t *testing.T, conn *websocket.Conn, msgType string) []byte {
+	t.Helper()
+	messageType, data := readMessage(t, conn)
+	if messageType != websocket.TextMessage || peekMessageType(data) != msgType {
+		t.Fatalf("got %q, want a %s message", data, msgType)
+	}
+	return data
+}
+
+// expectAudio reads the next message and checks that it is the given binary frame.
+func expectAudio(t *testing.T, conn *websocket.Conn, want string) {
+	t.Helper()
+	messageType, data := readMessage(t, conn)
+	if messageType != websocket.BinaryMessage || string(data) != want {
+		t.Fatalf("got (%d, %q), want audio %q", messageType, data, want)
+	}
+}
+
+func TestProxyForwardsBothWays(t *testing.T) {
+	_, dial := startProxy(t)
+	client := dial()
+
+	client.WriteMessage(websocket.TextMessage, []byte(`{"type":"Settings"}`))
+	expectText(t, client, "SettingsApplied")
+
+	client.WriteMessage(websocket.BinaryMessage, []byte("audio"))
+	expectAudio(t, client, "audio")
+}
+
+func TestProxyMute(t *testing.T) {
+	fake, dial := startProxy(t)
+	client := dial()
+
+	client.WriteMessage(websocket.TextMessage, []byte(`{"type":"mute"}`))
+	if data := expectText(t, client, msgMuteState); !strings.Contains(string(data), `"muted":true`) {
+		t.Fatalf("mute: got %s", data)
+	}
+	// Muted audio is replaced by at most one KeepAlive per mutedKeepAliveInterval
+	client.WriteMessage(websocket.BinaryMessage, []byte("dropped"))
+	client.WriteMessage(websocket.BinaryMessage, []byte("dropped"))
+
+	client.WriteMessage(websocket.TextMessage, []byte(`{"type":"unmute"}`))
+	if data := expectText(t, client, msgMuteState); !strings.Contains(string(data), `"muted":false`) {
+		t.Fatalf("unmute: got %s", data)
+	}
+	client.WriteMessage(websocket.BinaryMessage, []byte("kept"))
+	expectAudio(t, client, "kept")
+
+	// The fake has read everything sent before "kept"
+	var got []string
+	for len(fake.received) > 0 {
+		got = append(got, <-fake.received)
+	}
+	if len(got) != 1 || got[0] != msgAgentKeepAlive {
+		t.Errorf("Deepgram received %v while muted, want one %s", got, msgAgentKeepAlive)
+	}
+}
+
+func TestProxyForwardsDeepgramCloseReason(t *testing.T) {
+	fake, dial := startProxy(t)
+	client := dial()
+
+	fake.send(websocket.CloseMessage, string(websocket.FormatCloseMessage(4001, "quota exceeded")))
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := client.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != 4001 || ce.Text != "quota exceeded" {
+		t.Fatalf("got %v, want close 4001 \"quota exceeded\"", err)
+	}
+}
+
+func TestProxyClientCloseHandshake(t *testing.T) {
+	fake, dial := startProxy(t)
+	client := dial()
+
+	client.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := client.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("got %v, want the close frame echoed", err)
+	}
+
+	select {
+	case code := <-fake.closed:
+		if code != websocket.CloseNormalClosure {
+			t.Errorf("Deepgram connection closed with %d, want %d", code, websocket.CloseNormalClosure)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Deepgram connection was not closed")
+	}
+}
+
+func TestProxyFlushesCoalescedAudioOnWindow(t *testing.T) {
+	fake, dial := startProxy(t)
+	appConfig.audioCoalesceWindow = 20 * time.Millisecond
+	appConfig.audioCoalesceBytes = 1 << 20
+	client := dial()
+
+	// No further frame or event follows, so only the window can flush these
+	fake.send(websocket.BinaryMessage, "ab")
+	fake.send(websocket.BinaryMessage, "cd")
+	expectAudio(t, client, "abcd")
+}
+
+func TestProxySendsLatencyEvents(t *testing.T) {
+	fake, dial := startProxy(t)
+	appConfig.metricsEvents = true
+	client := dial()
+
+	for _, msgType := range []string{msgUserStartedSpeaking, msgAgentThinking, msgAgentStartedSpeaking} {
+		fake.send(websocket.TextMessage, `{"type":"`+msgType+`"}`)
+		expectText(t, client, msgType)
+	}
+	var latency struct {
+		ThinkingMs *int64 `json:"thinking_ms"`
+		SpeakingMs *int64 `json:"speaking_ms"`
+	}
+	json.Unmarshal(expectText(t, client, msgLatency), &latency)
+	if latency.ThinkingMs == nil || latency.SpeakingMs == nil || *latency.SpeakingMs < *latency.ThinkingMs {
+		t.Errorf("unexpected latency message: %+v", latency)
+	}
+}
+
+func TestProxyClosesDeepgramWhenClientStalls(t *testing.T) {
+	fake, dial := startProxy(t)
+	appConfig.writeTimeout = 100 * time.Millisecond
+	dial() // never read again, so the proxy's writes eventually time out
+
+	chunk := strings.Repeat("a", 64<<10)
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case code := <-fake.closed:
+			if code != websocket.CloseNormalClosure {
+				t.Errorf("Deepgram connection closed with %d, want %d", code, websocket.CloseNormalClosure)
+			}
+			return
+		case <-deadline:
+			t.Fatal("Deepgram connection still open after the client stalled")
+		default:
+			fake.send(websocket.BinaryMessage, chunk)
+		}
+	}
+}
+
+func TestProxyCountsAgentAudio(t *testing.T) {
+	fake, dial := startProxy(t)
+	appConfig.metricsEvents = true
+	client := dial()
+
+	// The fake echoes each chunk back as agent audio
+	for _, chunk := range []string{"abc", "defg", "hi"} {
+		client.WriteMessage(websocket.BinaryMessage, []byte(chunk))
+		expectAudio(t, client, chunk)
+	}
+	fake.send(websocket.TextMessage, `{"type":"AgentAudioDone"}`)
+	expectText(t, client, msgAgentAudioDone)
+
+	var total struct {
+		Total int64 `json:"total"`
+	}
+	json.Unmarshal(expectText(t, client, msgAudioBytes), &total)
+	if total.Total != 9 {
+		t.Errorf("agent_audio_bytes total = %d, want 9", total.Total)
+	}
+	conns := listConnections()
+	if len(conns) != 1 || conns[0].AgentAudioBytes != 9 {
+		t.Errorf("listConnections() = %+v, want one session with 9 bytes", conns)
+	}
+}
+
+func TestProxyTracksAgentSpeaking(t *testing.T) {
+	fake, dial := startProxy(t)
+	client := dial()
+
+	steps := []struct {
+		msgType string
+		want    int
+	}{
+		{msgAgentStartedSpeaking, 1},
+		{msgAgentAudioDone, 0},
+		{msgAgentStartedSpeaking, 1},
+		{msgUserStartedSpeaking, 0}, // barge-in without AgentAudioDone
+	}
+	for _, step := range steps {
+		fake.send(websocket.TextMessage, `{"type":"`+step.msgType+`"}`)
+		expectText(t, client, step.msgType)
+		if got := agentsSpeaking(); got != step.want {
+			t.Errorf("after %s: agentsSpeaking() = %d, want %d", step.msgType, got, step.want)
+		}
+	}
+}
+
+func TestProxyRefusesSessionsWhileShuttingDown(t *testing.T) {
+	startProxy(t)
+	shuttingDown.Store(true)
+	defer shuttingDown.Store(false)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/voice-agent", nil)
+	token, _ := issueToken(appConfig.sessionSecret)
+	r.Header.Set("Sec-WebSocket-Protocol", "access_token."+token)
+	w := httptest.NewRecorder()
+	handleVoiceAgent(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestConnectionCountMatchesAdminList(t *testing.T) {
+	_, dial := startProxy(t)
+	dial()
+
+	// A slot held by an upgrade still in its handshake is not a session yet
+	if err := reserveConnection(); err != nil {
+		t.Fatal(err)
+	}
+	defer releaseConnection()
+
+	listed := len(listConnections())
+	if listed != 1 || connectionCount() != listed || statsSnapshot().ActiveConnections != listed {
+		t.Errorf("listConnections: %d, connectionCount: %d, stats: %d; want all 1",
+			listed, connectionCount(), statsSnapshot().ActiveConnections)
+	}
+}
+
+// flakyDeepgram answers the first `failures` handshakes with 503 and upgrades after that.
+func flakyDeepgram(t *testing.T, failures int) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := failures > 0
+		failures--
+		mu.Unlock()
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil); err == nil {
+			conn.Close()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDialDeepgramRetries(t *testing.T) {
+	withConfig(t)
+	appConfig.deepgramAgentURL = "ws" + strings.TrimPrefix(flakyDeepgram(t, 1).URL, "http")
+	appConfig.connectAttempts = 3
+
+	var retries []int
+	conn, err := dialDeepgram(context.Background(), func(attempt int) {
+		retries = append(retries, attempt)
+	})
+	if err != nil {
+		t.Fatalf("dialDeepgram: %v", err)
+	}
+	conn.Close()
+	if len(retries) != 1 || retries[0] != 2 {
+		t.Errorf("retries = %v, want [2]", retries)
+	}
+}
+
+func TestDialDeepgramStopsWhenCancelled(t *testing.T) {
+	withConfig(t)
+	appConfig.deepgramAgentURL = "ws" + strings.TrimPrefix(flakyDeepgram(t, 100).URL, "http")
+	appConfig.connectAttempts = 5
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(50*time.Millisecond, func() { cancel(errSessionKicked) })
+	start := time.Now()
+	_, err := dialDeepgram(ctx, func(int) {})
+	if !errors.Is(err, errSessionKicked) {
+		t.Errorf("err = %v, want errSessionKicked", err)
+	}
+	// The first backoff alone is 500ms
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("dialDeepgram returned after %s, want it to stop on cancel", elapsed)
+	}
+}
+
+func TestClassifyAgentError(t *testing.T) {
+	tests := []struct {
+		code         string
+		wantSeverity string
+		wantAction   string
+	}{
+		{"CLIENT_MESSAGE_TIMEOUT", severityFatal, actionStop},
+		{"UNPARSABLE_CLIENT_MESSAGE", severityWarning, actionIgnore},
+		{"SOMETHING_NEW", severityTransient, actionIgnore},
+		{"", severityTransient, actionIgnore},
+	}
+	for _, tt := range tests {
+		severity, action := classifyAgentError(tt.code)
+		if severity != tt.wantSeverity || action != tt.wantAction {
+			t.Errorf("classifyAgentError(%q) = %s, %s; want %s, %s",
+				tt.code, severity, action, tt.wantSeverity, tt.wantAction)
+		}
+	}
+}
+
+func TestLogAgentProblemWarningsAreIgnored(t *testing.T) {
+	// A Warning event is never fatal, even with a code that is fatal in an Error
+	action, code := logAgentProblem("test", msgWarning, []byte(`{"type":"Warning","code":"CLIENT_MESSAGE_TIMEOUT"}`))
+	if action != actionIgnore || code != "CLIENT_MESSAGE_TIMEOUT" {
+		t.Errorf("logAgentProblem(Warning) = %s, %s; want %s", action, code, actionIgnore)
+	}
+}
+
+func TestProxyEndsSessionOnFatalError(t *testing.T) {
+	fake, dial := startProxy(t)
+	client := dial()
+
+	fake.send(websocket.TextMessage, `{"type":"Error","code":"CLIENT_MESSAGE_TIMEOUT","description":"no audio"}`)
+	expectText(t, client, msgError)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := client.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != websocket.CloseNormalClosure || ce.Text != "CLIENT_MESSAGE_TIMEOUT" {
+		t.Fatalf("got %v, want close 1000 \"CLIENT_MESSAGE_TIMEOUT\"", err)
+	}
+	select {
+	case <-fake.closed:
+	case <-time.After(time.Second):
+		t.Fatal("Deepgram connection was not closed")
+	}
+}
+
+func TestProxyKeepsSessionOnTransientError(t *testing.T) {
+	fake, dial := startProxy(t)
+	client := dial()
+
+	fake.send(websocket.TextMessage, `{"type":"Error","code":"SOMETHING_NEW"}`)
+	expectText(t, client, msgError)
+	client.WriteMessage(websocket.BinaryMessage, []byte("still here"))
+	expectAudio(t, client, "still here")
+}
+
+// serveAdmin sends a request for path to handler, registered on a mux under
+// pattern (e.g. "GET /api/admin/sessions/{id}/transcript") so path values work.
+func serveAdmin(pattern string, handler http.HandlerFunc, path, body string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pattern, handler)
+	method, _, _ := strings.Cut(pattern, " ")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+// waitForSessionsToEnd waits until no session is left in activeConnections.
+func waitForSessionsToEnd(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for connectionCount() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d session(s) still active", connectionCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAdminTranscript(t *testing.T) {
+	fake, dial := startProxy(t)
+	appConfig.adminToken = "admin"
+	client := dial()
+	id := listConnections()[0].ID
+	t.Cleanup(func() { endedTranscripts.Delete(id) })
+
+	// One turn more than the bound, so the oldest is dropped
+	for i := 0; i <= maxTranscriptTurns; i++ {
+		fake.send(websocket.TextMessage, fmt.Sprintf(`{"type":"ConversationText","role":"user","content":"turn %d"}`, i))
+		expectText(t, client, msgConversationText)
+	}
+
+	fetch := func(when string) {
+		t.Helper()
+		w := serveAdmin("GET /api/admin/sessions/{id}/transcript", handleAdminTranscript,
+			"/api/admin/sessions/"+id+"/transcript", "")
+		var transcript []transcriptEntry
+		if err := json.NewDecoder(w.Body).Decode(&transcript); w.Code != http.StatusOK || err != nil {
+			t.Fatalf("%s: status %d, decode error %v", when, w.Code, err)
+		}
+		if len(transcript) != maxTranscriptTurns || transcript[0].Content != "turn 1" ||
+			transcript[len(transcript)-1].Content != fmt.Sprintf("turn %d", maxTranscriptTurns) {
+			t.Errorf("%s: got %d turns from %q, want %d from \"turn 1\"",
+				when, len(transcript), transcript[0].Content, maxTranscriptTurns)
+		}
+	}
+	fetch("live session")
+	client.Close()
+	waitForSessionsToEnd(t)
+	fetch("ended session")
+
+	w := serveAdmin("GET /api/admin/sessions/{id}/transcript", handleAdminTranscript,
+		"/api/admin/sessions/unknown/transcript", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown session: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestTranscriptNotKeptWithoutAdminToken(t *testing.T) {
+	fake, dial := startProxy(t)
+	client := dial()
+	info := findSession(listConnections()[0].ID)
+
+	fake.send(websocket.TextMessage, `{"type":"ConversationText","role":"user","content":"hello"}`)
+	expectText(t, client, msgConversationText)
+	if transcript := info.transcriptSnapshot(); len(transcript) != 0 {
+		t.Errorf("transcript recorded without ADMIN_TOKEN: %+v", transcript)
+	}
+	client.Close()
+	waitForSessionsToEnd(t)
+	if _, ok := endedTranscripts.Load(info.ID); ok {
+		t.Error("transcript retained without ADMIN_TOKEN")
+	}
+}
+
+func TestProxyProtocolVersion(t *testing.T) {
+	_, dial := startProxy(t)
+	if conn := dial(protocolVersion); conn.Subprotocol() != protocolVersion {
+		t.Errorf("%s: server chose subprotocol %q", protocolVersion, conn.Subprotocol())
+	}
+
+	// The handler returns as soon as it has refused the version, so it can be
+	// served without startProxy's session tracking
+	proxy := httptest.NewServer(http.HandlerFunc(handleVoiceAgent))
+	defer proxy.Close()
+	conn := dialProxy(t, proxy.URL, "voiceagent.v2")
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != closeUnsupportedVersion ||
+		ce.Text != "unsupported protocol version; this server speaks voiceagent.v1" {
+		t.Fatalf("voiceagent.v2: got %v, want close %d naming %s", err, closeUnsupportedVersion, protocolVersion)
+	}
+}
+
+func TestAdminInject(t *testing.T) {
+	_, dial := startProxy(t)
+	client := dial()
+	id := listConnections()[0].ID
+
+	inject := func(id, body string) int {
+		return serveAdmin("POST /api/admin/sessions/{id}/inject", handleAdminInject,
+			"/api/admin/sessions/"+id+"/inject", body).Code
+	}
+
+	if code := inject(id, `{"content":"Hello there"}`); code != http.StatusAccepted {
+		t.Fatalf("inject: status %d, want %d", code, http.StatusAccepted)
+	}
+	var reply struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	json.Unmarshal(expectText(t, client, msgConversationText), &reply)
+	if reply.Role != "assistant" || reply.Content != "Hello there" {
+		t.Errorf("browser got %+v, want the assistant saying \"Hello there\"", reply)
+	}
+
+	if code := inject("unknown", `{"content":"Hello there"}`); code != http.StatusNotFound {
+		t.Errorf("unknown session: status %d, want %d", code, http.StatusNotFound)
+	}
+	if code := inject(id, `{"content":"  "}`); code != http.StatusBadRequest {
+		t.Errorf("empty content: status %d, want %d", code, http.StatusBadRequest)
+	}
+
+	// A session still dialing Deepgram has no upstream connection to write to
+	server, _ := newConnPair(t)
+	dialing := &connInfo{ID: "dialing", client: server}
+	activeConnections.Store(server, dialing)
+	defer activeConnections.Delete(server)
+	if code := inject(dialing.ID, `{"content":"Hello there"}`); code != http.StatusConflict {
+		t.Errorf("session without Deepgram: status %d, want %d", code, http.StatusConflict)
+	}
+}
+
+// expectClose reads until the connection fails and checks that it was closed with code.
+func expectClose(t *testing.T, conn *websocket.Conn, code int) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, code) {
+				t.Fatalf("got %v, want close %d", err, code)
+			}
+			return
+		}
+	}
+}
+
+// expectDeepgramClosed checks that the proxy closes the fake's connection.
+func expectDeepgramClosed(t *testing.T, fake *fakeDeepgram) {
+	t.Helper()
+	select {
+	case <-fake.closed:
+	case <-time.After(time.Second):
+		t.Fatal("Deepgram connection was not closed")
+	}
+}
+
+func TestAdminKick(t *testing.T) {
+	fake, dial := startProxy(t)
+	client := dial()
+
+	id := listConnections()[0].ID
+	w := serveAdmin("POST /api/admin/sessions/{id}/kick", handleAdminKick, "/api/admin/sessions/"+id+"/kick", "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("kick: status %d, want %d", w.Code, http.StatusAccepted)
+	}
+	expectClose(t, client, closeKicked)
+	expectDeepgramClosed(t, fake)
+
+	waitForSessionsToEnd(t)
+	w = serveAdmin("POST /api/admin/sessions/{id}/kick", handleAdminKick, "/api/admin/sessions/"+id+"/kick", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("kick of an ended session: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestProxyIdleTimeout(t *testing.T) {
+	fake, dial := startProxy(t)
+	appConfig.idleTimeout = 100 * time.Millisecond
+	client := dial()
+
+	expectClose(t, client, closeIdleTimeout)
+	expectDeepgramClosed(t, fake)
+}
+
+func TestProxySingleSession(t *testing.T) {
+	_, dial := startProxy(t)
+	appConfig.singleSession = true
+	first := dial()
+	second := dial()
+
+	expectText(t, first, msgSuperseded)
+	expectClose(t, first, closeSuperseded)
+	if n := connectionCount(); n != 1 {
+		t.Errorf("connectionCount() = %d, want 1", n)
+	}
+
+	second.WriteMessage(websocket.BinaryMessage, []byte("audio"))
+	expectAudio(t, second, "audio")
+}
+
+func TestAdminShutdown(t *testing.T) {
+	t.Cleanup(func() {
+		select {
+		case <-shutdownRequests:
+		default:
+		}
+	})
+
+	for i := 1; i <= 2; i++ {
+		done := make(chan int)
+		go func() {
+			done <- serveAdmin("POST /api/admin/shutdown", handleAdminShutdown, "/api/admin/shutdown", "").Code
+		}()
+		select {
+		case code := <-done:
+			if code != http.StatusAccepted {
+				t.Errorf("call %d: status %d, want %d", i, code, http.StatusAccepted)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("call %d blocked", i)
+		}
+		// The second call finds the first request still pending
+		if len(shutdownRequests) != 1 {
+			t.Fatalf("after call %d: %d pending shutdown requests, want 1", i, len(shutdownRequests))
+		}
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	withConfig(t)
+	appConfig.adminToken = "admin"
+	handler := requireAdmin(handleAdminStats)
+
+	tests := []struct {
+		authorization string
+		want          int
+	}{
+		{"Bearer admin", http.StatusOK},
+		{"admin", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Basic admin", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/admin/stats", nil)
+		if tt.authorization != "" {
+			r.Header.Set("Authorization", tt.authorization)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != tt.want {
+			t.Errorf("Authorization %q: status %d, want %d", tt.authorization, w.Code, tt.want)
+		}
+	}
+}
+
+func TestAdminConfigHidesSecrets(t *testing.T) {
+	withConfig(t)
+	appConfig.deepgramAPIKey = "sentinel-api-key"
+	appConfig.sessionSecret = []byte("sentinel-session-secret")
+	appConfig.adminToken = "sentinel-admin-token"
+
+	r := httptest.NewRequest(http.MethodGet, "/api/admin/config", nil)
+	r.Header.Set("Authorization", "Bearer "+appConfig.adminToken)
+	w := httptest.NewRecorder()
+	requireAdmin(handleAdminConfig)(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	for _, secret := range []string{"sentinel-api-key", "sentinel-session-secret", "sentinel-admin-token"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("config response contains %q: %s", secret, body)
+		}
+	}
+}
+
+func TestClientAddr(t *testing.T) {
+	withConfig(t)
+	networks, err := parseTrustedProxies("10.0.0.0/8, 192.0.2.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appConfig.trustedProxies = networks
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"loopback proxy", "127.0.0.1:5000", "203.0.113.9, 127.0.0.1", "203.0.113.9"},
+		{"IPv6 loopback proxy", "[::1]:5000", "203.0.113.9", "203.0.113.9"},
+		{"trusted range", "10.1.2.3:5000", "203.0.113.9", "203.0.113.9"},
+		{"trusted address", "192.0.2.7:5000", "203.0.113.9", "203.0.113.9"},
+		{"direct client", "198.51.100.4:5000", "203.0.113.9", "198.51.100.4:5000"},
+		{"no header", "127.0.0.1:5000", "", "127.0.0.1:5000"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/voice-agent", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := clientAddr(r); got != tt.want {
+			t.Errorf("%s: clientAddr() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := parseTrustedProxies("10.0.0.0/8,not-an-ip"); err == nil {
+		t.Error("parseTrustedProxies accepted an invalid entry")
+	}
+}
+
+func TestProxyRejectsOversizedFrames(t *testing.T) {
+	fake, dial := startProxy(t)
+	appConfig.maxMessageBytes = 16
+	client := dial()
+
+	client.WriteMessage(websocket.BinaryMessage, []byte(strings.Repeat("a", 17)))
+	expectClose(t, client, websocket.CloseMessageTooBig)
+	expectDeepgramClosed(t, fake)
+}
+
+func TestProxyHeartbeat(t *testing.T) {
+	_, dial := startProxy(t)
+	appConfig.heartbeatInterval = 50 * time.Millisecond
+	client := dial()
+
+	var heartbeat struct {
+		ServerTimeMs int64 `json:"server_time_ms"`
+	}
+	json.Unmarshal(expectText(t, client, msgHeartbeat), &heartbeat)
+	if skew := time.Since(time.UnixMilli(heartbeat.ServerTimeMs)); skew < 0 || skew > time.Second {
+		t.Errorf("server_time_ms is %s from now", skew)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	withConfig(t)
+	saved := redactions
+	t.Cleanup(func() { redactions = saved })
+
+	t.Setenv("DEEPGRAM_API_KEY", "test-key")
+	t.Setenv("DEEPGRAM_ENDPOINT", "ws://localhost:9000/agent")
+	t.Setenv("MAX_CONNECTIONS", "5")
+	t.Setenv("ALLOWED_ORIGINS", "https://voice.example.com/")
+	if err := loadConfig(); err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if appConfig.deepgramAgentURL != "ws://localhost:9000/agent" || appConfig.maxConnections != 5 ||
+		len(appConfig.allowedOrigins) != 1 || appConfig.allowedOrigins[0] != "https://voice.example.com" {
+		t.Errorf("unexpected config: url %q, maxConnections %d, origins %v",
+			appConfig.deepgramAgentURL, appConfig.maxConnections, appConfig.allowedOrigins)
+	}
+
+	tests := []struct {
+		name, value string
+	}{
+		{"DEEPGRAM_API_KEY", ""},
+		{"DEEPGRAM_ENDPOINT", "https://agent.example.com"},
+		{"MAX_CONNECTIONS", "-1"},
+		{"REDACT_PATTERN", "("},
+		{"TRUSTED_PROXIES", "proxy.internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.name, tt.value)
+			if err := loadConfig(); err == nil || !strings.Contains(err.Error(), tt.name) {
+				t.Errorf("%s=%q: err = %v, want an error naming %s", tt.name, tt.value, err, tt.name)
+			}
+		})
+	}
+}
+
+func TestValidateMetadata(t *testing.T) {
+	if err := validateMetadata("deepgram.toml"); err != nil {
+		t.Errorf("repository deepgram.toml: %v", err)
+	}
+
+	noMeta := t.TempDir() + "/deepgram.toml"
+	os.WriteFile(noMeta, []byte("[build]\ncommand = \"go build\"\n"), 0o644)
+	if err := validateMetadata(noMeta); err == nil || !strings.Contains(err.Error(), "[meta]") {
+		t.Errorf("file without [meta]: err = %v", err)
+	}
+	if err := validateMetadata(t.TempDir() + "/missing.toml"); err == nil {
+		t.Error("missing file: no error")
+	}
+}
+
+// logBuffer collects log output; sessions left over from earlier tests may
+// still be logging, so reads and writes are locked.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLog collects log output for the rest of the test.
+func captureLog(t *testing.T) *logBuffer {
+	t.Helper()
+	buf := &logBuffer{}
+	saved := log.Writer()
+	log.SetOutput(buf)
+	t.Cleanup(func() { log.SetOutput(saved) })
+	return buf
+}
+
+func TestLogRequests(t *testing.T) {
+	withConfig(t)
+	appConfig.accessLog = true
+	handler := logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	request := func(path string) string {
+		buf := captureLog(t)
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		return buf.String()
+	}
+
+	line := regexp.MustCompile(`method=GET path=/api/metadata status=418 duration=\d+\S* remote=192\.0\.2\.1:1234`)
+	if got := request("/api/metadata"); !line.MatchString(got) {
+		t.Errorf("access log = %q, want a line matching %s", got, line)
+	}
+	if got := request("/health"); got != "" {
+		t.Errorf("health check logged without debug: %q", got)
+	}
+	appConfig.debug = true
+	if got := request("/health"); !strings.Contains(got, "path=/health status=418") {
+		t.Errorf("health check not logged with debug: %q", got)
+	}
+}
+
+func TestHandleVersion(t *testing.T) {
+	version := func() map[string]string {
+		w := httptest.NewRecorder()
+		handleVersion(w, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+		var got map[string]string
+		json.NewDecoder(w.Body).Decode(&got)
+		return got
+	}
+
+	got := version()
+	if got["version"] != "dev" || got["commit"] != "unknown" || got["buildTime"] != "unknown" || got["goVersion"] == "" {
+		t.Errorf("defaults: got %v", got)
+	}
+
+	savedVersion, savedCommit, savedBuildTime := Version, Commit, BuildTime
+	t.Cleanup(func() { Version, Commit, BuildTime = savedVersion, savedCommit, savedBuildTime })
+	Version, Commit, BuildTime = "v1.2.3", "abc1234", "2026-01-02T03:04:05Z"
+	got = version()
+	if got["version"] != "v1.2.3" || got["commit"] != "abc1234" || got["buildTime"] != "2026-01-02T03:04:05Z" {
+		t.Errorf("build values: got %v", got)
+	}
+}
+
+func TestCloseAllConnections(t *testing.T) {
+	_, dial := startProxy(t)
+	clients := []*websocket.Conn{dial(), dial()}
+
+	if n := closeAllConnections(websocket.CloseGoingAway, "Server shutting down"); n != 2 {
+		t.Errorf("closeAllConnections() = %d, want 2", n)
+	}
+	for _, client := range clients {
+		expectClose(t, client, websocket.CloseGoingAway)
+	}
+	if n := connectionCount(); n != 0 {
+		t.Errorf("connectionCount() = %d, want 0", n)
+	}
+}
+
+func TestGracefulShutdownRunsOnce(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(handleHealth))
+	defer srv.Close()
+	t.Cleanup(func() {
+		shutdownOnce = sync.Once{}
+		shuttingDown.Store(false)
+	})
+	logs := captureLog(t)
+
+	var wg sync.WaitGroup
+	for _, reason := range []string{"SIGTERM signal received", "Admin shutdown requested"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gracefulShutdown(srv.Config, reason)
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("gracefulShutdown did not return")
+	}
+
+	if n := strings.Count(logs.String(), "Shutdown complete"); n != 1 {
+		t.Errorf("teardown ran %d times, want 1", n)
+	}
+	if !shuttingDown.Load() {
+		t.Error("shuttingDown not set")
+	}
+	if _, err := http.Get(srv.URL + "/health"); err == nil {
+		t.Error("server still accepting requests after shutdown")
+	}
+}